@@ -0,0 +1,86 @@
+package captcha
+
+import (
+	"context"
+	"errors"
+	"log"
+	"messageboard/config"
+	"os"
+	"sync"
+)
+
+/*
+* Captcha
+*
+* 註冊與留言的防刷驗證，支援自架的工作量證明（PoW）與 hCaptcha / Turnstile 類型的第三方服務
+* 以環境變數 CAPTCHA_PROVIDER 選擇：none, pow, hcaptcha, turnstile
+ */
+
+// 驗證服務名稱
+const (
+	ProviderNone      = "none"
+	ProviderPoW       = "pow"
+	ProviderHCaptcha  = "hcaptcha"
+	ProviderTurnstile = "turnstile"
+)
+
+var (
+	ErrRequired = errors.New("缺少驗證資訊")
+	ErrInvalid  = errors.New("驗證失敗，請重新驗證")
+)
+
+// 用戶端送出的驗證資訊
+type Response struct {
+	Token    string `json:"token"`    // 第三方服務的回應 token，或 PoW 的 challenge
+	Solution string `json:"solution"` // PoW 的解答
+	RemoteIP string `json:"-"`        // 用戶端 IP，由伺服器填入
+}
+
+// 驗證器
+type Verifier interface {
+	// 驗證服務名稱
+	Provider() string
+	// 提供給前端的驗證資訊（如 PoW 題目或第三方服務的 site key）
+	Challenge() (map[string]interface{}, error)
+	// 驗證用戶端送出的資訊，失敗時回傳 ErrRequired 或 ErrInvalid
+	Verify(ctx context.Context, resp Response) error
+}
+
+var (
+	setupOnce sync.Once
+	verifier  Verifier
+)
+
+// 依環境變數取得驗證器
+func Default() Verifier {
+	setupOnce.Do(func() {
+		verifier = FromEnv()
+	})
+	return verifier
+}
+
+// 依環境變數建立驗證器，未設定或設定錯誤時不啟用驗證
+func FromEnv() Verifier {
+	switch provider := os.Getenv("CAPTCHA_PROVIDER"); provider {
+	case "", ProviderNone:
+		return noopVerifier{}
+	case ProviderPoW:
+		store := &PostgresChallengeStore{}
+		go runChallengeJanitor(store)
+		return NewPoWVerifier(powSecret(), config.GetEnvAsInt("CAPTCHA_DIFFICULTY", defaultDifficulty), store)
+	case ProviderHCaptcha, ProviderTurnstile:
+		return NewHTTPVerifier(provider, os.Getenv("CAPTCHA_SITE_KEY"), os.Getenv("CAPTCHA_SECRET"), os.Getenv("CAPTCHA_VERIFY_URL"))
+	default:
+		log.Printf("未知的 CAPTCHA_PROVIDER：%s，不啟用驗證\n", provider)
+		return noopVerifier{}
+	}
+}
+
+// 未啟用驗證
+type noopVerifier struct{}
+
+func (noopVerifier) Provider() string { return ProviderNone }
+func (noopVerifier) Challenge() (map[string]interface{}, error) {
+	return map[string]interface{}{"provider": ProviderNone}, nil
+}
+func (noopVerifier) Verify(ctx context.Context, resp Response) error { return nil }
@@ -0,0 +1,86 @@
+package captcha
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// 第三方驗證服務的預設驗證網址
+var defaultVerifyURLs = map[string]string{
+	ProviderHCaptcha:  "https://api.hcaptcha.com/siteverify",
+	ProviderTurnstile: "https://challenges.cloudflare.com/turnstile/v0/siteverify",
+}
+
+// hCaptcha / Turnstile 類型的驗證服務
+// 以表單 POST secret、response、remoteip 到驗證網址，回應 JSON 中的 success 表示是否通過
+// 測試時可將 CAPTCHA_VERIFY_URL 指向本機的替身服務
+type HTTPVerifier struct {
+	provider  string
+	siteKey   string
+	secret    string
+	verifyURL string
+	client    *http.Client
+}
+
+func NewHTTPVerifier(provider, siteKey, secret, verifyURL string) *HTTPVerifier {
+	if verifyURL == "" {
+		verifyURL = defaultVerifyURLs[provider]
+	}
+	return &HTTPVerifier{
+		provider:  provider,
+		siteKey:   siteKey,
+		secret:    secret,
+		verifyURL: verifyURL,
+		client:    &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+func (h *HTTPVerifier) Provider() string { return h.provider }
+
+func (h *HTTPVerifier) Challenge() (map[string]interface{}, error) {
+	return map[string]interface{}{
+		"provider": h.provider,
+		"site_key": h.siteKey,
+	}, nil
+}
+
+func (h *HTTPVerifier) Verify(ctx context.Context, resp Response) error {
+	if resp.Token == "" {
+		return ErrRequired
+	}
+
+	form := url.Values{}
+	form.Set("secret", h.secret)
+	form.Set("response", resp.Token)
+	if resp.RemoteIP != "" {
+		form.Set("remoteip", resp.RemoteIP)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, h.verifyURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	res, err := h.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	var result struct {
+		Success    bool     `json:"success"`
+		ErrorCodes []string `json:"error-codes"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&result); err != nil {
+		return err
+	}
+	if !result.Success {
+		return ErrInvalid
+	}
+	return nil
+}
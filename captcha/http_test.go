@@ -0,0 +1,80 @@
+package captcha
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// 模擬 hCaptcha / Turnstile 驗證服務的替身，token 為 "pass" 時通過
+func newStubVerifyServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			t.Errorf("ParseForm() error = %v", err)
+		}
+		if got := r.PostForm.Get("secret"); got != "test-secret" {
+			t.Errorf("secret = %q, want %q", got, "test-secret")
+		}
+		if got := r.PostForm.Get("remoteip"); got != "203.0.113.1" {
+			t.Errorf("remoteip = %q, want %q", got, "203.0.113.1")
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if r.PostForm.Get("response") == "pass" {
+			w.Write([]byte(`{"success": true}`))
+			return
+		}
+		w.Write([]byte(`{"success": false, "error-codes": ["invalid-input-response"]}`))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestHTTPVerify(t *testing.T) {
+	server := newStubVerifyServer(t)
+	h := NewHTTPVerifier(ProviderTurnstile, "site-key", "test-secret", server.URL)
+
+	tests := []struct {
+		name  string
+		token string
+		want  error
+	}{
+		{"success", "pass", nil},
+		{"failure", "fail", ErrInvalid},
+		{"missing token", "", ErrRequired},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := h.Verify(context.Background(), Response{Token: tt.token, RemoteIP: "203.0.113.1"})
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("Verify() error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestHTTPVerifyUnavailable(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	server.Close()
+	h := NewHTTPVerifier(ProviderHCaptcha, "site-key", "test-secret", server.URL)
+
+	err := h.Verify(context.Background(), Response{Token: "pass"})
+	if err == nil || errors.Is(err, ErrInvalid) {
+		t.Fatalf("Verify() error = %v, want connection error", err)
+	}
+}
+
+func TestFromEnv(t *testing.T) {
+	t.Setenv("CAPTCHA_PROVIDER", ProviderTurnstile)
+	t.Setenv("CAPTCHA_VERIFY_URL", "http://127.0.0.1/verify")
+	if got := FromEnv().Provider(); got != ProviderTurnstile {
+		t.Fatalf("Provider() = %q, want %q", got, ProviderTurnstile)
+	}
+
+	t.Setenv("CAPTCHA_PROVIDER", "unknown")
+	if got := FromEnv().Provider(); got != ProviderNone {
+		t.Fatalf("Provider() = %q, want %q", got, ProviderNone)
+	}
+}
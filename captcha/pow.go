@@ -0,0 +1,128 @@
+package captcha
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"math/bits"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	defaultDifficulty = 20              // 預設需要的前導零位元數
+	maxDifficulty     = 32              // 難度上限，避免設定錯誤導致用戶端無法解題
+	challengeTTL      = 5 * time.Minute // 題目有效期間
+)
+
+// 自架的工作量證明驗證
+// 伺服器簽發含有效期限與難度的題目，用戶端需找出 solution 使
+// SHA-256("{challenge}:{solution}") 的前 difficulty 個位元皆為 0
+type PoWVerifier struct {
+	secret     []byte
+	difficulty int
+	store      ChallengeStore // 已使用的題目，避免重放
+}
+
+func NewPoWVerifier(secret []byte, difficulty int, store ChallengeStore) *PoWVerifier {
+	if difficulty <= 0 {
+		difficulty = defaultDifficulty
+	}
+	return &PoWVerifier{
+		secret:     secret,
+		difficulty: min(difficulty, maxDifficulty),
+		store:      store,
+	}
+}
+
+func (p *PoWVerifier) Provider() string { return ProviderPoW }
+
+// 簽發題目，格式為 base64(payload).base64(hmac)
+// payload：16 bytes 亂數 + 8 bytes 到期時間 + 1 byte 難度
+func (p *PoWVerifier) Challenge() (map[string]interface{}, error) {
+	payload := make([]byte, 25)
+	if _, err := rand.Read(payload[:16]); err != nil {
+		return nil, err
+	}
+	expiresAt := time.Now().Add(challengeTTL)
+	binary.BigEndian.PutUint64(payload[16:24], uint64(expiresAt.Unix()))
+	payload[24] = byte(p.difficulty)
+
+	challenge := base64.RawURLEncoding.EncodeToString(payload) + "." +
+		base64.RawURLEncoding.EncodeToString(p.sign(payload))
+
+	return map[string]interface{}{
+		"provider":   ProviderPoW,
+		"challenge":  challenge,
+		"difficulty": p.difficulty,
+		"algorithm":  "sha256",
+		"expires_at": expiresAt,
+	}, nil
+}
+
+func (p *PoWVerifier) Verify(ctx context.Context, resp Response) error {
+	if resp.Token == "" || resp.Solution == "" {
+		return ErrRequired
+	}
+
+	encodedPayload, encodedSig, ok := strings.Cut(resp.Token, ".")
+	if !ok {
+		return ErrInvalid
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(encodedPayload)
+	if err != nil || len(payload) != 25 {
+		return ErrInvalid
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(encodedSig)
+	if err != nil || !hmac.Equal(sig, p.sign(payload)) {
+		return ErrInvalid
+	}
+
+	expiresAt := time.Unix(int64(binary.BigEndian.Uint64(payload[16:24])), 0)
+	if time.Now().After(expiresAt) {
+		return ErrInvalid
+	}
+
+	sum := sha256.Sum256([]byte(resp.Token + ":" + resp.Solution))
+	if leadingZeroBits(sum[:]) < int(payload[24]) {
+		return ErrInvalid
+	}
+
+	// 簽章已驗證，payload 中的亂數即可識別題目，同一題只能通過一次
+	fresh, err := p.store.MarkUsed(ctx, encodedPayload, expiresAt)
+	if err != nil {
+		return err
+	}
+	if !fresh {
+		return ErrInvalid
+	}
+	return nil
+}
+
+func (p *PoWVerifier) sign(payload []byte) []byte {
+	mac := hmac.New(sha256.New, p.secret)
+	mac.Write(payload)
+	return mac.Sum(nil)
+}
+
+func leadingZeroBits(hash []byte) int {
+	count := 0
+	for _, b := range hash {
+		if b == 0 {
+			count += 8
+			continue
+		}
+		return count + bits.LeadingZeros8(b)
+	}
+	return count
+}
+
+// 由 JWT_SECRET 衍生題目的簽章金鑰
+func powSecret() []byte {
+	key := sha256.Sum256([]byte(os.Getenv("JWT_SECRET") + ":captcha"))
+	return key[:]
+}
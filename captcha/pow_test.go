@@ -0,0 +1,149 @@
+package captcha
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// 以記憶體保存題目紀錄的替身
+type stubChallengeStore struct {
+	used map[string]time.Time
+	err  error
+}
+
+func newStubChallengeStore() *stubChallengeStore {
+	return &stubChallengeStore{used: make(map[string]time.Time)}
+}
+
+func (s *stubChallengeStore) MarkUsed(ctx context.Context, id string, expiresAt time.Time) (bool, error) {
+	if s.err != nil {
+		return false, s.err
+	}
+	if _, exists := s.used[id]; exists {
+		return false, nil
+	}
+	s.used[id] = expiresAt
+	return true, nil
+}
+
+func (s *stubChallengeStore) Evict(now time.Time) {}
+
+// 暴力找出符合難度的解答
+func solve(t *testing.T, challenge string, difficulty int) string {
+	t.Helper()
+	for i := 0; i < 1<<24; i++ {
+		solution := strconv.Itoa(i)
+		sum := sha256.Sum256([]byte(challenge + ":" + solution))
+		if leadingZeroBits(sum[:]) >= difficulty {
+			return solution
+		}
+	}
+	t.Fatal("找不到解答")
+	return ""
+}
+
+func newChallenge(t *testing.T, p *PoWVerifier) string {
+	t.Helper()
+	data, err := p.Challenge()
+	if err != nil {
+		t.Fatalf("Challenge() error = %v", err)
+	}
+	return data["challenge"].(string)
+}
+
+func TestPoWVerify(t *testing.T) {
+	p := NewPoWVerifier([]byte("secret"), 8, newStubChallengeStore())
+	challenge := newChallenge(t, p)
+	solution := solve(t, challenge, 8)
+
+	if err := p.Verify(context.Background(), Response{Token: challenge, Solution: solution}); err != nil {
+		t.Fatalf("Verify() error = %v", err)
+	}
+	// 同一題不能通過兩次
+	if err := p.Verify(context.Background(), Response{Token: challenge, Solution: solution}); !errors.Is(err, ErrInvalid) {
+		t.Fatalf("replay Verify() error = %v, want ErrInvalid", err)
+	}
+}
+
+func TestPoWVerifyRejectsInvalid(t *testing.T) {
+	p := NewPoWVerifier([]byte("secret"), 8, newStubChallengeStore())
+	challenge := newChallenge(t, p)
+	solution := solve(t, challenge, 8)
+
+	// 以不同金鑰簽發的題目
+	other := NewPoWVerifier([]byte("other"), 8, newStubChallengeStore())
+	forged := newChallenge(t, other)
+
+	// 已過期的題目
+	payload := make([]byte, 25)
+	binary.BigEndian.PutUint64(payload[16:24], uint64(time.Now().Add(-time.Minute).Unix()))
+	payload[24] = 8
+	expired := base64.RawURLEncoding.EncodeToString(payload) + "." + base64.RawURLEncoding.EncodeToString(p.sign(payload))
+
+	tests := []struct {
+		name string
+		resp Response
+		want error
+	}{
+		{"missing token", Response{Solution: solution}, ErrRequired},
+		{"missing solution", Response{Token: challenge}, ErrRequired},
+		{"malformed token", Response{Token: "abc", Solution: solution}, ErrInvalid},
+		{"forged signature", Response{Token: forged, Solution: solve(t, forged, 8)}, ErrInvalid},
+		{"expired", Response{Token: expired, Solution: solve(t, expired, 8)}, ErrInvalid},
+		{"wrong solution", Response{Token: challenge, Solution: wrongSolution(challenge, 8)}, ErrInvalid},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := p.Verify(context.Background(), tt.resp); !errors.Is(err, tt.want) {
+				t.Fatalf("Verify() error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestPoWVerifyStoreError(t *testing.T) {
+	store := newStubChallengeStore()
+	store.err = errors.New("db down")
+	p := NewPoWVerifier([]byte("secret"), 8, store)
+	challenge := newChallenge(t, p)
+
+	err := p.Verify(context.Background(), Response{Token: challenge, Solution: solve(t, challenge, 8)})
+	if err == nil || errors.Is(err, ErrInvalid) {
+		t.Fatalf("Verify() error = %v, want store error", err)
+	}
+}
+
+// 找出不符合難度的解答
+func wrongSolution(challenge string, difficulty int) string {
+	for i := 0; ; i++ {
+		solution := strconv.Itoa(i)
+		sum := sha256.Sum256([]byte(challenge + ":" + solution))
+		if leadingZeroBits(sum[:]) < difficulty {
+			return solution
+		}
+	}
+}
+
+func TestLeadingZeroBits(t *testing.T) {
+	tests := []struct {
+		hash []byte
+		want int
+	}{
+		{[]byte{0xff}, 0},
+		{[]byte{0x01}, 7},
+		{[]byte{0x00, 0x80}, 8},
+		{[]byte{0x00, 0x00, 0x10}, 19},
+		{[]byte{0x00, 0x00}, 16},
+	}
+	for _, tt := range tests {
+		if got := leadingZeroBits(tt.hash); got != tt.want {
+			t.Errorf("leadingZeroBits(%x) = %d, want %d", tt.hash, got, tt.want)
+		}
+	}
+}
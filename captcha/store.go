@@ -0,0 +1,37 @@
+package captcha
+
+import (
+	"context"
+	"log"
+	"messageboard/models"
+	"time"
+)
+
+// 已使用題目的紀錄方式，多個服務實例需共用同一份紀錄才能防止重放
+type ChallengeStore interface {
+	// 記錄題目已使用，題目先前已使用過時回傳 false
+	MarkUsed(ctx context.Context, id string, expiresAt time.Time) (bool, error)
+	// 清除已過期的紀錄，由 janitor 定期呼叫
+	Evict(now time.Time)
+}
+
+// 保存在資料庫中的題目紀錄
+type PostgresChallengeStore struct{}
+
+func (s *PostgresChallengeStore) MarkUsed(ctx context.Context, id string, expiresAt time.Time) (bool, error) {
+	return models.MarkChallengeUsed(models.DB.WithContext(ctx), id, expiresAt)
+}
+
+func (s *PostgresChallengeStore) Evict(now time.Time) {
+	if err := models.DeleteExpiredChallenges(models.DB, now); err != nil {
+		log.Printf("清除驗證題目紀錄失敗: %v\n", err)
+	}
+}
+
+func runChallengeJanitor(store ChallengeStore) {
+	ticker := time.NewTicker(challengeTTL)
+	defer ticker.Stop()
+	for now := range ticker.C {
+		store.Evict(now)
+	}
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"flag"
+	"log"
+
+	"messageboard/models"
+
+	"gorm.io/gorm"
+)
+
+// 一次性的網址遷移指令：依目前的網址正規化規則與網站設定，更新既有留言的網址並合併留言串
+// 需在新版服務啟動過一次（完成資料表遷移）後執行
+//
+//	go run ./cmd/canonicalize-urls -dry-run
+//	go run ./cmd/canonicalize-urls
+func main() {
+	dryRun := flag.Bool("dry-run", false, "只統計需更新的留言，不寫入資料庫")
+	flag.Parse()
+
+	models.ConnectDB()
+
+	// 在同一個交易中更新，失敗時不留下部分遷移的資料
+	var updated int64
+	var merged int
+	err := models.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		updated, merged, err = models.RecanonicalizeCommentURLs(tx, *dryRun)
+		return err
+	})
+	if err != nil {
+		log.Fatal("網址遷移失敗：", err)
+	}
+
+	if *dryRun {
+		log.Printf("共 %d 則留言需更新網址，將合併為 %d 個網址\n", updated, merged)
+		return
+	}
+	log.Printf("已更新 %d 則留言的網址，合併為 %d 個網址\n", updated, merged)
+}
@@ -0,0 +1,21 @@
+package main
+
+import (
+	"log"
+
+	"messageboard/models"
+)
+
+// 立即輪替 JWT 簽章金鑰（JWT_ALG 為 RS256 或 EdDSA 時），舊金鑰在 JWT_KEY_RETENTION 期間內仍可驗證
+// 平時依 JWT_KEY_ROTATION 自動輪替，金鑰可能外洩時再手動執行
+//
+//	go run ./cmd/rotate-jwt-key
+func main() {
+	models.ConnectDB()
+
+	key, err := models.RotateSigningKey(models.DB)
+	if err != nil {
+		log.Fatal("輪替金鑰失敗：", err)
+	}
+	log.Printf("已產生新的 %s 金鑰：%s\n", key.Algorithm, key.Kid)
+}
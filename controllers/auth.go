@@ -1,33 +1,117 @@
 package controllers
 
 import (
+	"context"
+	"errors"
+	"log"
+	"math"
+	"messageboard/captcha"
+	"messageboard/config"
 	"messageboard/models"
+	"messageboard/notifiers"
 	"net/http"
-	"os"
+	"strconv"
+	"sync"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v5"
 	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
 )
 
 /*
 * Auth
 *
-* Register, Login
+* Register, Login, RefreshToken, Logout, VerifyEmail, ResendVerification, GetLoginAttempts
+* 登入後簽發短效的 Access Token 與可輪替的 Refresh Token（保存在 sessions 資料表）
  */
 
+// Access Token 與 Refresh Token 的有效期間
+const (
+	defaultAccessTokenTTL  = 15 * time.Minute
+	defaultRefreshTokenTTL = 30 * 24 * time.Hour
+)
+
+func accessTokenTTL() time.Duration {
+	return config.GetEnvAsDuration("ACCESS_TOKEN_TTL", defaultAccessTokenTTL)
+}
+
+func refreshTokenTTL() time.Duration {
+	return config.GetEnvAsDuration("REFRESH_TOKEN_TTL", defaultRefreshTokenTTL)
+}
+
+// 登入失敗的延遲與鎖定規則，MAX_FAILURES 設為 0 表示不鎖定
+func loginPolicy() models.LoginPolicy {
+	return models.LoginPolicy{
+		Window:        config.GetEnvAsDuration("LOGIN_FAILURE_WINDOW", 15*time.Minute),
+		BaseDelay:     time.Second,
+		MaxDelay:      config.GetEnvAsDuration("LOGIN_MAX_DELAY", 30*time.Second),
+		Lockout:       config.GetEnvAsDuration("LOGIN_LOCKOUT_DURATION", 15*time.Minute),
+		DelayAfter:    config.GetEnvAsInt("LOGIN_DELAY_AFTER", 3),
+		MaxFailures:   config.GetEnvAsInt("LOGIN_MAX_FAILURES", 10),
+		IPDelayAfter:  config.GetEnvAsInt("LOGIN_IP_DELAY_AFTER", 10),
+		IPMaxFailures: config.GetEnvAsInt("LOGIN_IP_MAX_FAILURES", 50),
+	}
+}
+
+// 登入嘗試紀錄的保留期間（LOGIN_ATTEMPT_RETENTION），至少保留計算失敗次數所需的期間
+func loginAttemptRetention() time.Duration {
+	return max(config.GetEnvAsDuration("LOGIN_ATTEMPT_RETENTION", 30*24*time.Hour), loginPolicy().Retention())
+}
+
+// 定期清除超過保留期間的登入嘗試紀錄，ctx 結束時停止
+func RunLoginAttemptJanitor(ctx context.Context) {
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			if err := models.DeleteLoginAttemptsBefore(models.DB, now.Add(-loginAttemptRetention())); err != nil {
+				log.Printf("清除登入紀錄失敗: %v\n", err)
+			}
+		}
+	}
+}
+
+var (
+	dummyHashOnce sync.Once
+	dummyHash     []byte
+)
+
+// 帳號不存在時用來比對的密碼雜湊，使回應時間與密碼錯誤時相近
+func dummyPasswordHash() []byte {
+	dummyHashOnce.Do(func() {
+		dummyHash, _ = bcrypt.GenerateFromPassword([]byte("dummy-password"), bcrypt.DefaultCost)
+	})
+	return dummyHash
+}
+
 func Register(c *gin.Context) {
 	var input struct {
-		Username string `json:"username" binding:"required,min=3,max=20"`
-		Email    string `json:"email" binding:"required,email"`
-		Password string `json:"password" binding:"required,min=6,max=20"`
+		Username string           `json:"username" binding:"required,min=3,max=20"`
+		Email    string           `json:"email" binding:"required,email"`
+		Password string           `json:"password" binding:"required,min=6,max=20"`
+		Captcha  captcha.Response `json:"captcha"` // 防刷驗證，依 CAPTCHA_PROVIDER 設定
 	}
 	if err := c.ShouldBindJSON(&input); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "格式錯誤或欄位缺失"})
 		return
 	}
 
+	// 檢查 Email 網域是否允許註冊（ALLOWED_DOMAINS / DENIED_DOMAINS）
+	if err := models.RegistrationDomainPolicy().CheckEmail(input.Email); err != nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	}
+
+	// 防刷驗證
+	if !verifyCaptcha(c, input.Captcha) {
+		return
+	}
+
 	// 檢查 email 是否已存在
 	var existing models.User
 	if err := models.DB.Where("email = ?", input.Email).First(&existing).Error; err == nil {
@@ -49,19 +133,22 @@ func Register(c *gin.Context) {
 		RoleID:   1, // 預設 Reader 角色
 	}
 
-	if err := models.DB.Create(&newUser).Error; err != nil {
+	// 使用者與驗證信在同一個交易中寫入，驗證信由背景 worker 寄送
+	err = models.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&newUser).Error; err != nil {
+			return err
+		}
+		return notifiers.EnqueueAccountEmail(tx, models.EventAccountVerifyEmail, newUser)
+	})
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "註冊失敗"})
 		return
 	}
+	notifiers.Wake()
 
 	c.JSON(http.StatusOK, gin.H{
-		"message": "註冊成功",
-		"user": gin.H{
-			"id":       newUser.ID,
-			"username": newUser.Username,
-			"email":    newUser.Email,
-			"role_id":  newUser.RoleID,
-		},
+		"message": "註冊成功，請至信箱收取驗證信",
+		"user":    newAccountResponse(newUser),
 	})
 }
 
@@ -76,40 +163,298 @@ func Login(c *gin.Context) {
 		return
 	}
 
+	// 暴力破解防護：帳號或 IP 失敗次數過多時需等待，不論帳號是否存在回應都相同
+	// 檢查與記錄在同一個交易中完成，記錄後的嘗試在驗證完成前即計入失敗次數
+	attempt := models.LoginAttempt{
+		Email:     models.NormalizeLoginEmail(input.Email),
+		IP:        c.ClientIP(),
+		UserAgent: c.Request.UserAgent(),
+	}
+	retryAfter, err := loginPolicy().BeginAttempt(models.DB, &attempt, time.Now())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "登入失敗", "details": err.Error()})
+		return
+	}
+	if retryAfter > 0 {
+		seconds := int(math.Ceil(retryAfter.Seconds()))
+		c.Header("Retry-After", strconv.Itoa(seconds))
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": "登入失敗次數過多，請稍後再試", "retry_after": seconds})
+		return
+	}
+
+	// 帳號不存在時仍比對一次密碼，避免由回應時間判斷帳號是否存在
 	var user models.User
-	if err := models.DB.Where("email = ?", input.Email).First(&user).Error; err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "使用者不存在"})
+	hashedPassword := dummyPasswordHash()
+	if err := models.DB.Where("email = ?", input.Email).First(&user).Error; err == nil {
+		hashedPassword = []byte(user.Password)
+		attempt.UserID = &user.ID
+	}
+	if err := bcrypt.CompareHashAndPassword(hashedPassword, []byte(input.Password)); err != nil || attempt.UserID == nil {
+		if err := models.FinishLoginAttempt(models.DB, &attempt, models.LoginFailure); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "登入失敗", "details": err.Error()})
+			return
+		}
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Email 或密碼錯誤"})
+		return
+	}
+
+	if err := models.FinishLoginAttempt(models.DB, &attempt, models.LoginSuccess); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "登入失敗", "details": err.Error()})
 		return
 	}
 
-	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(input.Password)); err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "密碼錯誤"})
+	// 建立工作階段並產生 JWT Token
+	tokens, err := startSession(c, user)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "產生 token 失敗"})
+		return
+	}
+
+	tokens["message"] = "登入成功"
+	c.JSON(http.StatusOK, tokens)
+}
+
+// 以 Refresh Token 換發新的 Access Token，Refresh Token 每次使用後輪替
+// 已輪替過的 Refresh Token 再次被使用時，視為外洩並登出此次登入的所有裝置
+func RefreshToken(c *gin.Context) {
+	var input struct {
+		RefreshToken string `json:"refresh_token" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "參數錯誤"})
+		return
+	}
+
+	session, refreshToken, err := models.RotateSession(models.DB, input.RefreshToken, c.Request.UserAgent(), c.ClientIP(), refreshTokenTTL())
+	if err != nil {
+		if errors.Is(err, models.ErrInvalidRefreshToken) || errors.Is(err, models.ErrRefreshTokenReused) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "換發 token 失敗", "details": err.Error()})
+		return
+	}
+
+	var user models.User
+	if err := models.DB.First(&user, session.UserID).Error; err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "用戶不存在"})
+		return
+	}
+
+	tokenString, err := issueAccessToken(user, session.FamilyID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "產生 token 失敗"})
 		return
 	}
 
-	// 產生 JWT Token
-	// 設定 Token 的過期時間為 72 小時
+	c.JSON(http.StatusOK, gin.H{
+		"message":       "換發成功",
+		"token":         tokenString,
+		"refresh_token": refreshToken,
+		"expires_in":    int(accessTokenTTL().Seconds()),
+	})
+}
+
+// 登出目前的登入，all 為 true 時登出所有裝置
+// 可另外帶入 refresh_token，一併撤銷其所屬的登入
+func Logout(c *gin.Context) {
+	var input struct {
+		RefreshToken string `json:"refresh_token"`
+		All          bool   `json:"all"`
+	}
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "參數錯誤"})
+			return
+		}
+	}
+
+	user := c.MustGet("currentUser").(models.User)
+
+	err := models.DB.Transaction(func(tx *gorm.DB) error {
+		if input.All {
+			// 遞增 Token 版本，連同舊版未綁定工作階段的 Token 一併失效
+			if err := tx.Model(&user).UpdateColumn("token_version", gorm.Expr("token_version + 1")).Error; err != nil {
+				return err
+			}
+			return models.RevokeUserSessions(tx, user.ID)
+		}
+		if sessionID := c.GetString("sessionID"); sessionID != "" {
+			if err := models.RevokeSessionFamily(tx, sessionID); err != nil {
+				return err
+			}
+		}
+		if input.RefreshToken != "" {
+			session, err := models.FindSessionByRefreshToken(tx, input.RefreshToken)
+			if err == nil && session.UserID == user.ID {
+				return models.RevokeSessionFamily(tx, session.FamilyID)
+			}
+			if err != nil && !errors.Is(err, models.ErrInvalidRefreshToken) {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "登出失敗", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "已登出"})
+}
+
+// 建立新的登入工作階段，回傳 Access Token 與 Refresh Token
+func startSession(c *gin.Context, user models.User) (gin.H, error) {
+	session, refreshToken, err := models.CreateSession(models.DB, user.ID, "", c.Request.UserAgent(), c.ClientIP(), refreshTokenTTL())
+	if err != nil {
+		return nil, err
+	}
+	tokenString, err := issueAccessToken(user, session.FamilyID)
+	if err != nil {
+		return nil, err
+	}
+	return gin.H{
+		"token":         tokenString,
+		"refresh_token": refreshToken,
+		"expires_in":    int(accessTokenTTL().Seconds()),
+	}, nil
+}
+
+// 簽發短效的 Access Token，帶有使用者目前的 Token 版本與工作階段
+func issueAccessToken(user models.User, sessionID string) (string, error) {
 	claims := models.AppClaims{ // 使用自訂 struct
-		UserID: user.ID,
+		UserID:    user.ID,
+		Version:   user.TokenVersion,
+		SessionID: sessionID,
 		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(8 * time.Hour)),
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(accessTokenTTL())),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
 			NotBefore: jwt.NewNumericDate(time.Now()),
 			// Issuer:    "your_app_name", // 可選
 			// Subject:   strconv.FormatUint(uint64(user.ID), 10), // 可選
 		},
 	}
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims) // 傳入 claims struct
 
-	// 簽署 Token
-	tokenString, err := token.SignedString([]byte(os.Getenv("JWT_SECRET")))
+	// 依 JWT_ALG 簽署 Token
+	return models.SignAppToken(claims)
+}
+
+// 以驗證信中的連結驗證 Email，token 可放在查詢參數或 JSON 中
+// 重複驗證視為成功
+func VerifyEmail(c *gin.Context) {
+	var input struct {
+		Token string `json:"token"`
+	}
+	input.Token = c.Query("token")
+	if input.Token == "" && c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "參數錯誤"})
+			return
+		}
+	}
+	if input.Token == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "缺少 token 參數"})
+		return
+	}
+
+	claims, err := models.ParsePurposeToken(input.Token, models.PurposeVerifyEmail)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "產生 token 失敗"})
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
+	// 連結需對應使用者目前的 Email，變更 Email 後舊連結失效
+	var user models.User
+	if err := models.DB.First(&user, claims.UserID).Error; err != nil || user.Email != claims.Scope {
+		c.JSON(http.StatusBadRequest, gin.H{"error": models.ErrInvalidPurposeToken.Error()})
+		return
+	}
+
+	if !user.EmailVerified {
+		now := time.Now()
+		if err := models.DB.Model(&user).Updates(map[string]interface{}{
+			"email_verified":    true,
+			"email_verified_at": now,
+		}).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "驗證 Email 失敗", "details": err.Error()})
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Email 驗證成功"})
+}
+
+// 重新寄送驗證信給目前登入的使用者
+func ResendVerification(c *gin.Context) {
+	user := c.MustGet("currentUser").(models.User)
+
+	if user.EmailVerified {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Email 已驗證"})
+		return
+	}
+	if !notifiers.Enabled() {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "尚未設定 Email 寄送，無法寄送驗證信"})
+		return
+	}
+
+	if err := notifiers.EnqueueAccountEmail(models.DB, models.EventAccountVerifyEmail, user); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "寄送驗證信失敗", "details": err.Error()})
+		return
+	}
+	notifiers.Wake()
+
+	c.JSON(http.StatusOK, gin.H{"message": "驗證信已寄出，請至信箱收取"})
+}
+
+// 列出登入嘗試紀錄（僅限管理員），依時間由新到舊
+// 可依 email、ip、result 篩選；分頁參數：limit, cursor（上一頁最後一筆的 id）
+func GetLoginAttempts(c *gin.Context) {
+	limit := defaultPageLimit
+	if raw := c.Query("limit"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": errInvalidPageParams.Error()})
+			return
+		}
+		limit = min(n, maxPageLimit)
+	}
+
+	query := models.DB.Model(&models.LoginAttempt{})
+	if email := c.Query("email"); email != "" {
+		query = query.Where("email = ?", models.NormalizeLoginEmail(email))
+	}
+	if ip := c.Query("ip"); ip != "" {
+		query = query.Where("ip = ?", ip)
+	}
+	if result := c.Query("result"); result != "" {
+		query = query.Where("result = ?", result)
+	}
+	if cursor := c.Query("cursor"); cursor != "" {
+		id, err := strconv.ParseUint(cursor, 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": errInvalidPageParams.Error()})
+			return
+		}
+		query = query.Where("id < ?", id)
+	}
+
+	var attempts []models.LoginAttempt
+	if err := query.Order("id DESC").Limit(limit + 1).Find(&attempts).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "查詢登入紀錄失敗", "details": err.Error()})
+		return
+	}
+
+	nextCursor := ""
+	if len(attempts) > limit {
+		attempts = attempts[:limit]
+		nextCursor = strconv.FormatUint(uint64(attempts[len(attempts)-1].ID), 10)
+	}
+
 	c.JSON(http.StatusOK, gin.H{
-		"message": "登入成功",
-		"token":   tokenString,
+		"message":     "查詢成功",
+		"attempts":    newLoginAttemptResponses(attempts),
+		"limit":       limit,
+		"next_cursor": nextCursor,
+		"has_more":    nextCursor != "",
 	})
 }
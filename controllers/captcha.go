@@ -0,0 +1,41 @@
+package controllers
+
+import (
+	"errors"
+	"messageboard/captcha"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+/*
+* Captcha
+*
+* GetCaptchaChallenge
+* 取得註冊、留言所需的防刷驗證資訊
+ */
+
+func GetCaptchaChallenge(c *gin.Context) {
+	challenge, err := captcha.Default().Challenge()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "產生驗證題目失敗"})
+		return
+	}
+	c.JSON(http.StatusOK, challenge)
+}
+
+// 驗證用戶端送出的防刷驗證資訊，失敗時直接回應錯誤並回傳 false
+func verifyCaptcha(c *gin.Context, resp captcha.Response) bool {
+	resp.RemoteIP = c.ClientIP()
+	err := captcha.Default().Verify(c.Request.Context(), resp)
+	if err == nil {
+		return true
+	}
+
+	if errors.Is(err, captcha.ErrRequired) || errors.Is(err, captcha.ErrInvalid) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	} else {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "驗證服務暫時無法使用，請稍後再試"})
+	}
+	return false
+}
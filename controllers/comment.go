@@ -1,78 +1,167 @@
 package controllers
 
 import (
-	"log"
+	"errors"
+	"messageboard/captcha"
+	"messageboard/config"
 	"messageboard/models"
+	"messageboard/notifiers"
 	"net/http"
-	"net/url"
-	"os"
-	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
-	mail "github.com/xhit/go-simple-mail/v2"
+	"gorm.io/gorm"
 )
 
 /*
 * Comment
 *
-* CreateComment, GetComments, DeleteComment, GetCommentByID, ToggleCommentLike
+* CreateComment, GetComments, GetCommentsByURL, DeleteComment, PurgeComment, GetCommentByID, ToggleCommentLike
 * 這些函數處理留言的建立、查詢、刪除和點讚功能
  */
 
+// 建立留言，登入的使用者以帳號留言；開啟訪客模式時，未登入者可填寫顯示名稱留言
 func CreateComment(c *gin.Context) {
 	var input struct {
-		URL      string `json:"url" binding:"required"` // 留言的網址
-		Content  string `json:"content" binding:"required"`
-		ParentID *uint  `json:"parent_id"` // 可選，若為 nil 則表示為根留言
+		URL      string           `json:"url" binding:"required"` // 留言的網址
+		Content  string           `json:"content" binding:"required"`
+		ParentID *uint            `json:"parent_id"`                               // 可選，若為 nil 則表示為根留言
+		Captcha  captcha.Response `json:"captcha"`                                 // 防刷驗證，依 CAPTCHA_PROVIDER 設定
+		Name     string           `json:"name" binding:"max=50"`                   // 訪客顯示名稱
+		Email    string           `json:"email" binding:"omitempty,email,max=254"` // 訪客信箱（可選）
 	}
 	if err := c.ShouldBindJSON(&input); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "參數錯誤"})
 		return
 	}
 
-	// 驗證使用者是否登入
-	user := c.MustGet("currentUser").(models.User)
+	// 檢查 URL 是否有效，並依所屬網站的設定正規化，同一篇文章的不同寫法歸入同一個留言串
+	// 留言與審核設定依網站區分
+	canonicalURL, site, err := models.CanonicalizeCommentURL(models.DB, input.URL)
+	if errors.Is(err, models.ErrInvalidCommentURL) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "查詢網站失敗", "details": err.Error()})
+		return
+	}
+	if err := models.CheckCommentHost(models.DB, canonicalURL, site); err != nil {
+		if errors.Is(err, models.ErrCommentHostNotAllowed) {
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "查詢網站失敗", "details": err.Error()})
+		return
+	}
+	if site != nil {
+		// 瀏覽器送出的請求需來自網站允許的來源，避免替其他網站留言
+		if origin := c.GetHeader("Origin"); origin != "" && !site.AllowsOrigin(origin) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "請求來源不屬於此網站"})
+			return
+		}
+	}
+
+	// 未登入時僅在開啟訪客模式下允許留言
+	viewer := currentViewer(c)
+	if viewer == nil {
+		if !guestCommentsEnabled(site) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "未提供授權資訊"})
+			return
+		}
+		input.Name = strings.TrimSpace(input.Name)
+		if input.Name == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "請填寫顯示名稱"})
+			return
+		}
+	} else if !viewer.HasPermission(models.PermCommentCreate) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "權限不足"})
+		return
+	} else if config.GetEnvAsBool("REQUIRE_EMAIL_VERIFICATION", false) && !viewer.EmailVerified {
+		// 開啟後，尚未驗證 Email 的使用者不能留言
+		c.JSON(http.StatusForbidden, gin.H{"error": "請先驗證 Email 才能留言"})
+		return
+	}
+
+	// 防刷驗證
+	if !verifyCaptcha(c, input.Captcha) {
+		return
+	}
 
 	// 如果是回覆，確認父留言是否存在
 	if input.ParentID != nil {
 		var parentComment models.Comment
-		if err := models.DB.First(&parentComment, *input.ParentID).Error; err != nil {
+		if err := models.DB.Scopes(models.VisibleTo(viewer)).First(&parentComment, *input.ParentID).Error; err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "找不到要回覆的留言"})
 			return
 		}
 	}
 
-	// 檢查 URL 是否有效
-	u, err := url.ParseRequestURI(input.URL)
-	if err != nil || u.Scheme == "" || u.Host == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "網址格式錯誤"})
-		return
-	}
-
 	// 建立留言
 	comment := models.Comment{
-		URL:      input.URL,
+		URL:      canonicalURL,
 		ParentID: input.ParentID, // nil 表示主留言
-		UserID:   user.ID,
 		Content:  input.Content,
 	}
-	if err := models.DB.Create(&comment).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "建立留言失敗", "details": err.Error()})
-		return
+	if site != nil {
+		comment.SiteID = &site.ID
 	}
-
-	// 寄送通知信（可選）
-	if err := sendEmailNotification(comment); err != nil {
-		log.Printf("寄送通知信失敗: %v\n", err)
+	var editToken string
+	if viewer != nil {
+		comment.UserID = &viewer.ID
+		comment.Status = initialCommentStatus(*viewer, site)
 	} else {
-		log.Printf("成功寄送通知信給 %s\n", comment.User.Username)
+		editToken, err = newEditToken()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "建立留言失敗", "details": err.Error()})
+			return
+		}
+		editUntil := time.Now().Add(guestEditWindow())
+		comment.GuestName = input.Name
+		comment.GuestEmail = input.Email
+		comment.EditToken = models.HashEditToken(editToken)
+		comment.EditUntil = &editUntil
+		comment.Status = guestCommentStatus(site)
 	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"message": "留言成功",
-		"comment": comment,
+	// 留言與通知信（可選）在同一個交易中寫入，通知由背景 worker 寄送
+	err = models.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&comment).Error; err != nil {
+			return err
+		}
+		if err := models.RefreshCommentAncestors(tx, comment.ParentID); err != nil {
+			return err
+		}
+		notified := comment
+		if viewer != nil {
+			notified.User = *viewer
+		}
+		return notifiers.EnqueueCommentNotifications(tx, notified)
 	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "建立留言失敗", "details": err.Error()})
+		return
+	}
+	notifiers.Wake()
+	if viewer != nil {
+		comment.User = *viewer
+	}
+
+	message := "留言成功"
+	if comment.Status == models.CommentPending {
+		message = "留言成功，待審核後顯示"
+	}
+	response := gin.H{
+		"message": message,
+		"comment": newCommentResponse(comment),
+	}
+	// 編輯權杖只在建立時回傳一次，訪客需自行保存
+	if editToken != "" {
+		response["edit_token"] = editToken
+		response["edit_until"] = comment.EditUntil
+	}
+	c.JSON(http.StatusOK, response)
 }
 
 func UpdateComment(c *gin.Context) {
@@ -96,54 +185,128 @@ func UpdateComment(c *gin.Context) {
 	}
 
 	// 確認使用者是否為留言作者
-	if comment.UserID != user.ID {
+	if !user.CanManageComment(comment, models.PermCommentUpdateOwn, "") {
 		c.JSON(http.StatusForbidden, gin.H{"error": "無權限修改此留言"})
 		return
 	}
 
-	comment.Content = input.Content
-	if err := models.DB.Save(&comment).Error; err != nil {
+	// 只更新內容，避免覆寫同時發生的點讚數、審核狀態等變更
+	if err := models.DB.Model(&comment).Update("content", input.Content).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "更新留言失敗", "details": err.Error()})
 		return
 	}
+	comment.User = user
 
 	c.JSON(http.StatusOK, gin.H{
 		"message": "更新成功",
-		"comment": comment,
+		"comment": newCommentResponse(comment),
 	})
 }
 
 func GetComments(c *gin.Context) {
-	var comments []models.Comment
-	if err := models.DB.Preload("User").Order("created_at DESC").Find(&comments).Error; err != nil {
+	params, err := parsePageParams(c, SortNewest)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	query := models.DB.Scopes(models.VisibleTo(currentViewer(c)))
+	if siteID := c.Query("site_id"); siteID != "" {
+		query = query.Where("site_id = ?", siteID)
+	}
+
+	page, err := paginateComments(query, params)
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "查詢留言失敗: " + err.Error()})
 		return
 	}
-	c.JSON(http.StatusOK, gin.H{
-		"message":  "查詢成功",
-		"comments": comments,
-	})
+	respondCommentPage(c, page, params)
 }
 
 func DeleteComment(c *gin.Context) {
 	id := c.Param("id")
-	if err := models.DB.Delete(&models.Comment{}, id).Error; err != nil {
+
+	// 驗證使用者是否登入
+	user := c.MustGet("currentUser").(models.User)
+
+	// 查詢留言
+	var comment models.Comment
+	if err := models.DB.First(&comment, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "留言不存在"})
+		return
+	}
+
+	// 確認使用者為留言作者，或為可管理此留言的管理者
+	if !user.CanManageComment(comment, models.PermCommentDeleteOwn, models.PermCommentDeleteAny) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "無權限刪除此留言"})
+		return
+	}
+
+	// 軟刪除，保留回覆串；有回覆時列表中以墓碑呈現
+	if err := models.DB.Transaction(func(tx *gorm.DB) error {
+		return models.SoftDeleteComment(tx, &comment)
+	}); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "刪除留言失敗: " + err.Error()})
 		return
 	}
 	c.JSON(http.StatusOK, gin.H{"message": "刪除成功"})
 }
 
+// 永久刪除留言及其所有回覆、點讚與檢舉（僅限管理員）
+func PurgeComment(c *gin.Context) {
+	id := c.Param("id")
+
+	var comment models.Comment
+	if err := models.DB.Unscoped().First(&comment, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "留言不存在"})
+		return
+	}
+
+	var purged int64
+	err := models.DB.Transaction(func(tx *gorm.DB) error {
+		// 先鎖定留言與祖先，刪除後再更新祖先的墓碑狀態
+		if _, err := models.LockCommentChain(tx, comment.ID); err != nil {
+			return err
+		}
+		ids, err := models.CommentSubtreeIDs(tx, comment.ID)
+		if err != nil {
+			return err
+		}
+		if err := tx.Where("comment_id IN ?", ids).Delete(&models.CommentLike{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("comment_id IN ?", ids).Delete(&models.CommentReport{}).Error; err != nil {
+			return err
+		}
+		result := tx.Unscoped().Where("id IN ?", ids).Delete(&models.Comment{})
+		if result.Error != nil {
+			return result.Error
+		}
+		purged = result.RowsAffected
+		return models.RefreshCommentAncestors(tx, comment.ParentID)
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "永久刪除留言失敗: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":      "永久刪除成功",
+		"purged_count": purged,
+	})
+}
+
 func GetCommentByID(c *gin.Context) {
 	id := c.Param("id")
 	var comment models.Comment
-	if err := models.DB.Preload("User").First(&comment, id).Error; err != nil {
+	if err := models.DB.Scopes(models.WithTombstones, models.VisibleTo(currentViewer(c))).Preload("User").First(&comment, id).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "查詢留言失敗: " + err.Error()})
 		return
 	}
+	comment.Redact()
 	c.JSON(http.StatusOK, gin.H{
 		"message": "查詢成功",
-		"comment": comment,
+		"comment": newCommentResponse(comment),
 	})
 }
 
@@ -153,14 +316,29 @@ func GetCommentsByURL(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "缺少 url 參數"})
 		return
 	}
-	var comments []models.Comment
-	if err := models.DB.Where("url = ?", url).Preload("User").Find(&comments).Error; err != nil {
+	params, err := parsePageParams(c, SortNewest)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	page, err := paginateComments(models.DB.Scopes(models.VisibleTo(currentViewer(c))).Where("url = ?", queryURL(url)), params)
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "查詢留言失敗: " + err.Error()})
 		return
 	}
+	respondCommentPage(c, page, params)
+}
+
+func respondCommentPage(c *gin.Context, page commentPage, params pageParams) {
 	c.JSON(http.StatusOK, gin.H{
-		"message":  "查詢成功",
-		"comments": comments,
+		"message":     "查詢成功",
+		"comments":    newCommentResponses(page.Comments),
+		"total":       page.Total,
+		"limit":       params.Limit,
+		"sort":        params.Sort,
+		"next_cursor": page.NextCursor,
+		"has_more":    page.NextCursor != "",
 	})
 }
 
@@ -172,7 +350,7 @@ func ToggleCommentLike(c *gin.Context) {
 
 	// 檢查留言是否存在
 	var comment models.Comment
-	if err := models.DB.First(&comment, commentID).Error; err != nil {
+	if err := models.DB.Scopes(models.VisibleTo(&user)).First(&comment, commentID).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "留言不存在"})
 		return
 	}
@@ -184,8 +362,14 @@ func ToggleCommentLike(c *gin.Context) {
 		First(&existingLike).Error
 
 	if err == nil {
-		// 已點過讚 → 取消讚
-		if err := models.DB.Delete(&existingLike).Error; err != nil {
+		// 已點過讚 → 取消讚，並同步點讚數
+		err := models.DB.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Delete(&existingLike).Error; err != nil {
+				return err
+			}
+			return tx.Model(&comment).UpdateColumn("likes_count", gorm.Expr("likes_count - 1")).Error
+		})
+		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "取消讚失敗", "details": err.Error()})
 			return
 		}
@@ -193,12 +377,22 @@ func ToggleCommentLike(c *gin.Context) {
 		return
 	}
 
-	// 未點過讚 → 新增讚
+	// 未點過讚 → 新增讚，並同步點讚數與排程通知
 	newLike := models.CommentLike{
 		UserID:    user.ID,
 		CommentID: comment.ID,
 	}
-	if err := models.DB.Create(&newLike).Error; err != nil {
+	err = models.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&newLike).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&comment).UpdateColumn("likes_count", gorm.Expr("likes_count + 1")).Error; err != nil {
+			return err
+		}
+		// 點讚通知會彙整一段期間後才寄出
+		return notifiers.EnqueueLikeNotification(tx, comment, newLike)
+	})
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "點讚失敗", "details": err.Error()})
 		return
 	}
@@ -211,13 +405,13 @@ func GetCommentLikes(c *gin.Context) {
 
 	// 檢查留言是否存在
 	var comment models.Comment
-	if err := models.DB.First(&comment, commentID).Error; err != nil {
+	if err := models.DB.Scopes(models.VisibleTo(currentViewer(c))).First(&comment, commentID).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "留言不存在"})
 		return
 	}
 
 	var likes []models.CommentLike
-	if err := models.DB.Where("comment_id = ?", comment.ID).Find(&likes).Error; err != nil {
+	if err := models.DB.Preload("User").Where("comment_id = ?", comment.ID).Find(&likes).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "查詢點讚失敗", "details": err.Error()})
 		return
 	}
@@ -225,82 +419,42 @@ func GetCommentLikes(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{
 		"comment_id":  comment.ID,
 		"likes_count": len(likes),
-		"likes":       likes,
+		"likes":       newLikeResponses(likes),
 	})
 }
 
-func sendEmailNotification(comment models.Comment) error {
-	server := mail.NewSMTPClient()
-	server.Host = os.Getenv("MAIL_HOST")
-	server.Port = getEnvAsInt("MAIL_PORT", 587)
-	server.Username = os.Getenv("MAIL_USERNAME")
-	server.Password = os.Getenv("MAIL_PASSWORD")
-	server.Encryption = mail.EncryptionSTARTTLS
-	server.ConnectTimeout = 10 * time.Second
-	server.SendTimeout = 10 * time.Second
-
-	smtpClient, err := server.Connect()
+// 查詢時以與建立留言相同的規則正規化網址，無法正規化時以原值查詢
+func queryURL(raw string) string {
+	canonical, _, err := models.CanonicalizeCommentURL(models.DB, raw)
 	if err != nil {
-		return err
+		return raw
 	}
+	return canonical
+}
 
-	email := mail.NewMSG()
-	var toEmail string
-	var subject string
-
-	// 如果是回覆留言，通知父留言的作者
-	if comment.ParentID != nil {
-		var parentComment models.Comment
-		if err := models.DB.Preload("User").First(&parentComment, *comment.ParentID).Error; err == nil && parentComment.User.Email != "" {
-			toEmail = parentComment.User.Email
-			subject = "【留言通知】你有一則新回覆"
-		} else {
-			// 找不到父留言或父留言作者沒信箱，通知自己
-			toEmail = comment.User.Email
-			subject = "【留言通知】你有一則新留言"
-		}
-	} else {
-		// 主留言通知站長
-		toEmail = os.Getenv("MAIL_TO")
-		if toEmail == "" {
-			toEmail = comment.User.Email
-		}
-		subject = "【留言通知】你有一則新留言"
-	}
-
-	email.SetFrom(os.Getenv("MAIL_FROM")).
-		AddTo(toEmail).
-		SetSubject(subject)
-
-	// htmlBody := fmt.Sprintf("```markdown\n## 作者：%s\n## 時間：%s\n## 內容：\n%s\n```",
-	// 	comment.User.Username,
-	// 	comment.CreatedAt.Format("2006-01-02 15:04:05"),
-	// 	comment.Content,
-	// )
-
-	htmlBody := `
-		<html>
-		<body>
-			<h2>留言通知</h2>
-			<p>作者：` + comment.User.Username + `</p>
-			<p>時間：` + comment.CreatedAt.Format("2006-01-02 15:04:05") + `</p>
-			<p>▼▼▼內容如下▼▼▼</p>
-			<p>` + comment.Content + `</p>
-			<p>網址：<a href="` + comment.URL + `">` + comment.URL + `</a></p>
-			<br>
-			<p>感謝您的留言！</p>
-		</html>
-		`
-
-	email.SetBody(mail.TextHTML, htmlBody)
-
-	return email.Send(smtpClient)
+// 取得目前登入的使用者，未登入時回傳 nil
+func currentViewer(c *gin.Context) *models.User {
+	value, exists := c.Get("currentUser")
+	if !exists {
+		return nil
+	}
+	user, ok := value.(models.User)
+	if !ok {
+		return nil
+	}
+	return &user
 }
 
-func getEnvAsInt(key string, defaultValue int) int {
-	value, err := strconv.Atoi(os.Getenv(key))
-	if err != nil {
-		return defaultValue
+// 新留言的初始審核狀態
+// 開啟先審後發時，沒有審核權限的使用者留言需等待審核
+// 依網站的 pre_moderation 設定，未歸屬網站的留言使用 PRE_MODERATION
+func initialCommentStatus(user models.User, site *models.Site) string {
+	preModeration := config.GetEnvAsBool("PRE_MODERATION", false)
+	if site != nil {
+		preModeration = site.PreModeration
+	}
+	if preModeration && !user.HasPermission(models.PermCommentModerate) {
+		return models.CommentPending
 	}
-	return value
+	return models.CommentVisible
 }
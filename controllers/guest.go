@@ -0,0 +1,115 @@
+package controllers
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"messageboard/config"
+	"messageboard/models"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+/*
+* Guest
+*
+* UpdateGuestComment, DeleteGuestComment
+* 訪客模式：未登入的讀者以顯示名稱留言，並以建立時取得的編輯權杖在期限內修改或刪除留言
+ */
+
+// 訪客留言建立後可編輯、刪除的期限
+const defaultGuestEditWindow = 15 * time.Minute
+
+// 訪客以 X-Edit-Token 標頭帶入編輯權杖
+const editTokenHeader = "X-Edit-Token"
+
+// 是否開啟訪客留言，依網站設定，未歸屬網站的留言使用 GUEST_COMMENTS
+func guestCommentsEnabled(site *models.Site) bool {
+	if site != nil {
+		return site.GuestComments
+	}
+	return config.GetEnvAsBool("GUEST_COMMENTS", false)
+}
+
+func guestEditWindow() time.Duration {
+	return config.GetEnvAsDuration("GUEST_EDIT_WINDOW", defaultGuestEditWindow)
+}
+
+// 訪客留言的初始審核狀態，依網站設定，未歸屬網站的留言使用 GUEST_MODERATION（預設需等待審核）
+func guestCommentStatus(site *models.Site) string {
+	moderation := config.GetEnvAsBool("GUEST_MODERATION", true)
+	if site != nil {
+		moderation = site.GuestModeration
+	}
+	if moderation {
+		return models.CommentPending
+	}
+	return models.CommentVisible
+}
+
+// 產生隨機的編輯權杖，資料庫僅保存其雜湊值
+func newEditToken() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// 查詢訪客留言並驗證編輯權杖，失敗時直接回應錯誤
+func findGuestComment(c *gin.Context) (models.Comment, bool) {
+	var comment models.Comment
+	if err := models.DB.Where("user_id IS NULL").First(&comment, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "留言不存在"})
+		return comment, false
+	}
+	if !comment.CanGuestEdit(c.GetHeader(editTokenHeader), time.Now()) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "編輯權杖無效或已過期"})
+		return comment, false
+	}
+	return comment, true
+}
+
+func UpdateGuestComment(c *gin.Context) {
+	var input struct {
+		Content string `json:"content" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "參數錯誤"})
+		return
+	}
+
+	comment, ok := findGuestComment(c)
+	if !ok {
+		return
+	}
+
+	// 只更新內容，避免覆寫同時發生的點讚數、審核狀態等變更
+	if err := models.DB.Model(&comment).Update("content", input.Content).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "更新留言失敗", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "更新成功",
+		"comment": newCommentResponse(comment),
+	})
+}
+
+func DeleteGuestComment(c *gin.Context) {
+	comment, ok := findGuestComment(c)
+	if !ok {
+		return
+	}
+
+	// 與一般留言相同採軟刪除，有回覆時以墓碑呈現
+	if err := models.DB.Transaction(func(tx *gorm.DB) error {
+		return models.SoftDeleteComment(tx, &comment)
+	}); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "刪除留言失敗: " + err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "刪除成功"})
+}
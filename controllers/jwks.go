@@ -0,0 +1,28 @@
+package controllers
+
+import (
+	"messageboard/models"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+/*
+* JWKS
+*
+* GetJWKS
+* 公開驗證登入 Token 的金鑰，讓第三方可自行驗證 Token（僅限 RS256 / EdDSA）
+ */
+
+// GET /.well-known/jwks.json
+func GetJWKS(c *gin.Context) {
+	keys, err := models.PublicJWKs(models.DB)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "讀取金鑰失敗", "details": err.Error()})
+		return
+	}
+
+	// 金鑰輪替後舊金鑰仍會保留一段時間，短暫快取不影響驗證
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(http.StatusOK, gin.H{"keys": keys})
+}
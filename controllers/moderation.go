@@ -0,0 +1,84 @@
+package controllers
+
+import (
+	"messageboard/models"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+/*
+* Moderation
+*
+* GetModerationQueue, UpdateCommentStatus
+* 管理者（admin / author）審核、隱藏留言
+ */
+
+// 審核佇列：依狀態列出留言，預設列出待審核的留言
+func GetModerationQueue(c *gin.Context) {
+	user := c.MustGet("currentUser").(models.User)
+
+	status := c.DefaultQuery("status", models.CommentPending)
+	if !models.IsValidCommentStatus(status) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "無效的留言狀態"})
+		return
+	}
+
+	params, err := parsePageParams(c, SortOldest)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	query := models.DB.Scopes(models.VisibleTo(&user)).Where("status = ?", status)
+	if url := c.Query("url"); url != "" {
+		query = query.Where("url = ?", queryURL(url))
+	}
+	if siteID := c.Query("site_id"); siteID != "" {
+		query = query.Where("site_id = ?", siteID)
+	}
+
+	page, err := paginateComments(query, params)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "查詢留言失敗: " + err.Error()})
+		return
+	}
+	respondCommentPage(c, page, params)
+}
+
+// 變更留言的審核狀態（公開、隱藏、待審核、垃圾留言）
+func UpdateCommentStatus(c *gin.Context) {
+	id := c.Param("id")
+	var input struct {
+		Status string `json:"status" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil || !models.IsValidCommentStatus(input.Status) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "無效的留言狀態"})
+		return
+	}
+
+	user := c.MustGet("currentUser").(models.User)
+
+	var comment models.Comment
+	if err := models.DB.Preload("User").First(&comment, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "留言不存在"})
+		return
+	}
+
+	// 確認留言在使用者的管轄範圍內
+	if !user.Moderates(comment) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "無權限管理此留言"})
+		return
+	}
+
+	// 管理員決定的狀態不再視為自動隱藏，駁回檢舉時不會被恢復
+	if err := models.DB.Model(&comment).Updates(map[string]interface{}{"status": input.Status, "auto_hidden": false}).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "更新留言狀態失敗", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "更新成功",
+		"comment": newCommentResponse(comment),
+	})
+}
@@ -0,0 +1,207 @@
+package controllers
+
+import (
+	"html/template"
+	"messageboard/models"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+/*
+* Notification
+*
+* GetNotificationPreference, UpdateNotificationPreference, GetUnsubscribe, Unsubscribe
+* 使用者的 Email 通知偏好與免登入取消訂閱
+ */
+
+func GetNotificationPreference(c *gin.Context) {
+	user := c.MustGet("currentUser").(models.User)
+
+	pref, err := models.GetNotificationPreference(user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "查詢通知設定失敗", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":     "查詢成功",
+		"preferences": pref,
+	})
+}
+
+// 更新通知偏好，未提供的欄位維持原設定；none 為 true 時關閉全部通知
+// locale 為通知信語系（zh-TW、en），空字串表示使用預設語系
+func UpdateNotificationPreference(c *gin.Context) {
+	var input struct {
+		Replies *bool   `json:"replies"`
+		Likes   *bool   `json:"likes"`
+		Digest  *bool   `json:"digest"`
+		Locale  *string `json:"locale"`
+		None    bool    `json:"none"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "參數錯誤"})
+		return
+	}
+	if input.Locale != nil && *input.Locale != "" && !models.IsSupportedLocale(*input.Locale) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "不支援的語系"})
+		return
+	}
+
+	user := c.MustGet("currentUser").(models.User)
+
+	pref, err := models.GetNotificationPreference(user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "查詢通知設定失敗", "details": err.Error()})
+		return
+	}
+
+	if input.None {
+		pref.Disable(models.NotifyScopeAll)
+	} else {
+		if input.Replies != nil {
+			pref.NotifyReplies = *input.Replies
+		}
+		if input.Likes != nil {
+			pref.NotifyLikes = *input.Likes
+		}
+		if input.Digest != nil {
+			pref.NotifyDigest = *input.Digest
+		}
+	}
+	if input.Locale != nil {
+		pref.Locale = *input.Locale
+	}
+
+	// last_digest_at 由通知 worker 更新，不以讀取時的值覆寫
+	if err := models.DB.Omit("last_digest_at").Save(&pref).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "更新通知設定失敗", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":     "更新成功",
+		"preferences": pref,
+	})
+}
+
+// 取消訂閱確認頁，Email 連結以瀏覽器開啟時顯示，送出表單後以 POST 取消訂閱
+var unsubscribePage = template.Must(template.New("unsubscribe").Parse(`<!DOCTYPE html>
+<html lang="zh-Hant">
+<head>
+	<meta charset="utf-8">
+	<meta name="viewport" content="width=device-width, initial-scale=1">
+	<title>取消訂閱</title>
+</head>
+<body>
+	<h2>{{.Title}}</h2>
+	<p>{{.Message}}</p>
+	{{- if .Token}}
+	<form method="post" action="unsubscribe?token={{.Token}}">
+		<button type="submit">取消訂閱{{.Scope}}</button>
+	</form>
+	{{- end}}
+</body>
+</html>`))
+
+// 取消訂閱範圍的顯示名稱
+func unsubscribeScopeName(scope string) string {
+	switch scope {
+	case models.NotifyScopeReplies:
+		return "回覆通知"
+	case models.NotifyScopeLikes:
+		return "點讚通知"
+	case models.NotifyScopeDigest:
+		return "網站摘要"
+	default:
+		return "所有通知"
+	}
+}
+
+// 瀏覽器（Accept: text/html）回應 HTML 頁面，其他用戶端回應 JSON
+func respondUnsubscribe(c *gin.Context, status int, body gin.H, token string) {
+	if c.NegotiateFormat(gin.MIMEJSON, gin.MIMEHTML) != gin.MIMEHTML {
+		c.JSON(status, body)
+		return
+	}
+
+	page := struct {
+		Title, Message, Scope, Token string
+	}{Title: "取消訂閱", Token: token}
+	if message, ok := body["error"].(string); ok {
+		page.Title, page.Message = "無法取消訂閱", message
+	} else {
+		page.Message = body["message"].(string)
+	}
+	if scope, ok := body["scope"].(string); ok {
+		page.Scope = unsubscribeScopeName(scope)
+	}
+
+	c.Status(status)
+	c.Header("Content-Type", "text/html; charset=utf-8")
+	if err := unsubscribePage.Execute(c.Writer, page); err != nil {
+		c.Error(err)
+	}
+}
+
+// 確認取消訂閱連結並回傳範圍，不變更設定，避免郵件掃描或連結預先載入誤取消訂閱
+// 以瀏覽器開啟時顯示確認頁，表單送出後以 POST 取消訂閱
+func GetUnsubscribe(c *gin.Context) {
+	claims, ok := parseUnsubscribeToken(c)
+	if !ok {
+		return
+	}
+
+	respondUnsubscribe(c, http.StatusOK, gin.H{
+		"message": "確定不再收到" + unsubscribeScopeName(claims.Scope) + "嗎？",
+		"scope":   claims.Scope,
+	}, c.Query("token"))
+}
+
+// 透過 Email 中的簽章連結取消訂閱，不需登入（RFC 8058 一鍵取消訂閱或確認頁送出）
+func Unsubscribe(c *gin.Context) {
+	claims, ok := parseUnsubscribeToken(c)
+	if !ok {
+		return
+	}
+
+	pref, err := models.GetNotificationPreference(claims.UserID)
+	if err != nil {
+		respondUnsubscribe(c, http.StatusInternalServerError, gin.H{"error": "查詢通知設定失敗", "details": err.Error()}, "")
+		return
+	}
+
+	pref.Disable(claims.Scope)
+	if err := models.DB.Omit("last_digest_at").Save(&pref).Error; err != nil {
+		respondUnsubscribe(c, http.StatusInternalServerError, gin.H{"error": "取消訂閱失敗", "details": err.Error()}, "")
+		return
+	}
+
+	respondUnsubscribe(c, http.StatusOK, gin.H{
+		"message": "已取消訂閱",
+		"scope":   claims.Scope,
+	}, "")
+}
+
+// 驗證取消訂閱 token 並確認使用者仍存在，失敗時已寫入回應
+func parseUnsubscribeToken(c *gin.Context) (*models.PurposeClaims, bool) {
+	tokenString := c.Query("token")
+	if tokenString == "" {
+		respondUnsubscribe(c, http.StatusBadRequest, gin.H{"error": "缺少 token 參數"}, "")
+		return nil, false
+	}
+
+	claims, err := models.ParsePurposeToken(tokenString, models.PurposeUnsubscribe)
+	if err != nil {
+		respondUnsubscribe(c, http.StatusBadRequest, gin.H{"error": err.Error()}, "")
+		return nil, false
+	}
+
+	var user models.User
+	if err := models.DB.First(&user, claims.UserID).Error; err != nil {
+		respondUnsubscribe(c, http.StatusBadRequest, gin.H{"error": models.ErrInvalidPurposeToken.Error()}, "")
+		return nil, false
+	}
+	return claims, true
+}
@@ -0,0 +1,152 @@
+package controllers
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"messageboard/models"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+/*
+* Pagination
+*
+* 留言列表共用的 cursor 分頁與排序
+* 參數：limit, cursor, sort (newest, oldest, most_liked)
+ */
+
+const (
+	SortNewest    = "newest"
+	SortOldest    = "oldest"
+	SortMostLiked = "most_liked"
+)
+
+const (
+	defaultPageLimit = 20
+	maxPageLimit     = 100
+)
+
+var errInvalidPageParams = errors.New("分頁參數錯誤")
+
+// 不透明 cursor 的內容，僅供伺服器端解讀
+type commentCursor struct {
+	Sort       string    `json:"s"`
+	CreatedAt  time.Time `json:"t"`
+	LikesCount int64     `json:"l"`
+	ID         uint      `json:"i"`
+}
+
+type pageParams struct {
+	Limit  int
+	Sort   string
+	Cursor *commentCursor
+}
+
+type commentPage struct {
+	Comments   []models.Comment
+	Total      int64
+	NextCursor string
+}
+
+// 從 query string 解析分頁參數，未指定排序時使用 defaultSort
+func parsePageParams(c *gin.Context, defaultSort string) (pageParams, error) {
+	params := pageParams{Limit: defaultPageLimit, Sort: c.DefaultQuery("sort", defaultSort)}
+
+	switch params.Sort {
+	case SortNewest, SortOldest, SortMostLiked:
+	default:
+		return params, errInvalidPageParams
+	}
+
+	if limit := c.Query("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n <= 0 {
+			return params, errInvalidPageParams
+		}
+		params.Limit = min(n, maxPageLimit)
+	}
+
+	if raw := c.Query("cursor"); raw != "" {
+		cursor, err := decodeCursor(raw)
+		if err != nil || cursor.Sort != params.Sort {
+			return params, errInvalidPageParams
+		}
+		params.Cursor = cursor
+	}
+
+	return params, nil
+}
+
+func encodeCursor(cursor commentCursor) string {
+	data, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeCursor(raw string) (*commentCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(raw)
+	if err != nil {
+		return nil, err
+	}
+	var cursor commentCursor
+	if err := json.Unmarshal(data, &cursor); err != nil {
+		return nil, err
+	}
+	return &cursor, nil
+}
+
+// 依分頁參數查詢留言
+// query 為已套用篩選條件的 Comment 查詢，total 為篩選後的總筆數
+// 已刪除但仍有回覆的留言會以墓碑呈現
+func paginateComments(query *gorm.DB, params pageParams) (commentPage, error) {
+	var page commentPage
+	base := query.Model(&models.Comment{}).Scopes(models.WithTombstones).Session(&gorm.Session{})
+
+	if err := base.Count(&page.Total).Error; err != nil {
+		return page, err
+	}
+
+	q := base.Preload("User")
+	switch params.Sort {
+	case SortOldest:
+		if params.Cursor != nil {
+			q = q.Where("(created_at, id) > (?, ?)", params.Cursor.CreatedAt, params.Cursor.ID)
+		}
+		q = q.Order("created_at ASC, id ASC")
+	case SortMostLiked:
+		if params.Cursor != nil {
+			q = q.Where("(likes_count, id) < (?, ?)", params.Cursor.LikesCount, params.Cursor.ID)
+		}
+		q = q.Order("likes_count DESC, id DESC")
+	default:
+		if params.Cursor != nil {
+			q = q.Where("(created_at, id) < (?, ?)", params.Cursor.CreatedAt, params.Cursor.ID)
+		}
+		q = q.Order("created_at DESC, id DESC")
+	}
+
+	// 多取一筆用來判斷是否還有下一頁
+	if err := q.Limit(params.Limit + 1).Find(&page.Comments).Error; err != nil {
+		return page, err
+	}
+
+	for i := range page.Comments {
+		page.Comments[i].Redact()
+	}
+
+	if len(page.Comments) > params.Limit {
+		page.Comments = page.Comments[:params.Limit]
+		last := page.Comments[len(page.Comments)-1]
+		page.NextCursor = encodeCursor(commentCursor{
+			Sort:       params.Sort,
+			CreatedAt:  last.CreatedAt,
+			LikesCount: last.LikesCount,
+			ID:         last.ID,
+		})
+	}
+
+	return page, nil
+}
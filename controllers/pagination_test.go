@@ -0,0 +1,80 @@
+package controllers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func newQueryContext(query string) *gin.Context {
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodGet, "/?"+query, nil)
+	return c
+}
+
+func TestCursorRoundTrip(t *testing.T) {
+	cursor := commentCursor{
+		Sort:       SortMostLiked,
+		CreatedAt:  time.Date(2024, 5, 1, 12, 30, 0, 123456000, time.UTC),
+		LikesCount: 42,
+		ID:         7,
+	}
+
+	decoded, err := decodeCursor(encodeCursor(cursor))
+	if err != nil {
+		t.Fatalf("decodeCursor() error = %v", err)
+	}
+	if decoded.Sort != cursor.Sort || !decoded.CreatedAt.Equal(cursor.CreatedAt) || decoded.LikesCount != cursor.LikesCount || decoded.ID != cursor.ID {
+		t.Fatalf("decodeCursor() = %+v, want %+v", *decoded, cursor)
+	}
+}
+
+func TestDecodeCursorInvalid(t *testing.T) {
+	for _, raw := range []string{"!!!", "bm90IGpzb24"} {
+		if _, err := decodeCursor(raw); err == nil {
+			t.Errorf("decodeCursor(%q) error = nil, want error", raw)
+		}
+	}
+}
+
+func TestParsePageParams(t *testing.T) {
+	newest := encodeCursor(commentCursor{Sort: SortNewest, ID: 1})
+
+	tests := []struct {
+		name      string
+		query     string
+		wantSort  string
+		wantLimit int
+		wantErr   bool
+	}{
+		{"defaults", "", SortOldest, defaultPageLimit, false},
+		{"sort and limit", "sort=most_liked&limit=5", SortMostLiked, 5, false},
+		{"limit capped", "limit=1000", SortOldest, maxPageLimit, false},
+		{"matching cursor", "sort=newest&cursor=" + newest, SortNewest, defaultPageLimit, false},
+		{"unknown sort", "sort=random", "", 0, true},
+		{"invalid limit", "limit=0", "", 0, true},
+		{"non-numeric limit", "limit=abc", "", 0, true},
+		{"malformed cursor", "cursor=!!!", "", 0, true},
+		{"cursor from another sort", "sort=oldest&cursor=" + newest, "", 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			params, err := parsePageParams(newQueryContext(tt.query), SortOldest)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("parsePageParams(%q) error = nil, want error", tt.query)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parsePageParams(%q) error = %v", tt.query, err)
+			}
+			if params.Sort != tt.wantSort || params.Limit != tt.wantLimit {
+				t.Fatalf("parsePageParams(%q) = sort %q limit %d, want sort %q limit %d", tt.query, params.Sort, params.Limit, tt.wantSort, tt.wantLimit)
+			}
+		})
+	}
+}
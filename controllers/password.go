@@ -0,0 +1,167 @@
+package controllers
+
+import (
+	"errors"
+	"log"
+	"messageboard/models"
+	"messageboard/notifiers"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+/*
+* Password
+*
+* ForgotPassword, ResetPassword, ChangePassword
+* 忘記密碼、以 Email 連結重設密碼、登入後變更密碼
+* 密碼變更後 Token 版本遞增並撤銷所有工作階段，所有已登入的裝置都需重新登入
+ */
+
+// 申請重設密碼，寄送一次性的重設連結
+// 不論 Email 是否存在都回應相同訊息，避免被用來探測帳號
+func ForgotPassword(c *gin.Context) {
+	var input struct {
+		Email string `json:"email" binding:"required,email"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "參數錯誤"})
+		return
+	}
+
+	var user models.User
+	if err := models.DB.Where("email = ?", input.Email).First(&user).Error; err == nil {
+		if err := notifiers.EnqueueAccountEmail(models.DB, models.EventAccountPasswordReset, user); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "寄送重設密碼信失敗", "details": err.Error()})
+			return
+		}
+		notifiers.Wake()
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "若此 Email 已註冊，重設密碼的連結將寄至信箱"})
+}
+
+// 以重設密碼連結中的 token 設定新密碼，連結在密碼變更後即失效
+func ResetPassword(c *gin.Context) {
+	var input struct {
+		Token    string `json:"token" binding:"required"`
+		Password string `json:"password" binding:"required,min=6,max=20"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "參數錯誤"})
+		return
+	}
+
+	claims, err := models.ParsePurposeToken(input.Token, models.PurposeResetPassword)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// 確認連結對應目前的密碼，已使用過的連結會因密碼變更而失效
+	var user models.User
+	if err := models.DB.First(&user, claims.UserID).Error; err != nil || models.PasswordFingerprint(user) != claims.Scope {
+		c.JSON(http.StatusBadRequest, gin.H{"error": models.ErrInvalidPurposeToken.Error()})
+		return
+	}
+
+	// 能收到重設密碼信即代表擁有此信箱
+	// 密碼已在檢查後被變更（例如同時送出兩次重設）時，連結視為已使用
+	if err := setPassword(models.DB, &user, input.Password, map[string]interface{}{"email_verified": true}); errors.Is(err, errPasswordChanged) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": models.ErrInvalidPurposeToken.Error()})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "重設密碼失敗", "details": err.Error()})
+		return
+	}
+	// 以新密碼重新計算登入失敗次數，解除帳號鎖定
+	// 密碼已變更，失敗時仍回報錯誤，避免使用者以為鎖定已解除
+	if err := models.RecordLoginAttempt(models.DB, models.LoginAttempt{
+		Email:     models.NormalizeLoginEmail(user.Email),
+		UserID:    &user.ID,
+		IP:        c.ClientIP(),
+		UserAgent: c.Request.UserAgent(),
+		Result:    models.LoginSuccess,
+	}); err != nil {
+		log.Printf("解除登入鎖定失敗: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "密碼已重設，但解除登入鎖定失敗", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "密碼已重設，請使用新密碼登入"})
+}
+
+// 變更目前登入使用者的密碼，需提供目前的密碼
+// 變更後其他裝置的登入狀態失效，並回傳新的 Token 供目前的裝置繼續使用
+func ChangePassword(c *gin.Context) {
+	var input struct {
+		CurrentPassword string `json:"current_password" binding:"required"`
+		NewPassword     string `json:"new_password" binding:"required,min=6,max=20"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "參數錯誤"})
+		return
+	}
+
+	user := c.MustGet("currentUser").(models.User)
+
+	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(input.CurrentPassword)); err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "目前的密碼錯誤"})
+		return
+	}
+
+	if err := setPassword(models.DB, &user, input.NewPassword, nil); errors.Is(err, errPasswordChanged) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "目前的密碼錯誤"})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "變更密碼失敗", "details": err.Error()})
+		return
+	}
+
+	tokens, err := startSession(c, user)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "產生 token 失敗"})
+		return
+	}
+
+	tokens["message"] = "密碼已變更，其他裝置需重新登入"
+	c.JSON(http.StatusOK, tokens)
+}
+
+var errPasswordChanged = errors.New("密碼已被變更")
+
+// 更新密碼、遞增 Token 版本並撤銷所有工作階段，使先前簽發的 Token 全部失效
+// 只在密碼仍為 user 讀取時的密碼時更新，否則回傳 errPasswordChanged；extra 為需一併更新的欄位
+func setPassword(db *gorm.DB, user *models.User, password string, extra map[string]interface{}) error {
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	updates := map[string]interface{}{
+		"password":            string(hashedPassword),
+		"password_changed_at": now,
+		"token_version":       gorm.Expr("token_version + 1"),
+	}
+	for column, value := range extra {
+		updates[column] = value
+	}
+	return db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(user).Where("password = ?", user.Password).Updates(updates)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errPasswordChanged
+		}
+		if err := models.RevokeUserSessions(tx, user.ID); err != nil {
+			return err
+		}
+		// 重新讀取遞增後的 Token 版本
+		return tx.First(user, user.ID).Error
+	})
+}
@@ -0,0 +1,316 @@
+package controllers
+
+import (
+	"errors"
+	"messageboard/config"
+	"messageboard/models"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+/*
+* Report
+*
+* ReportComment, GetReports, ResolveReport, DismissReport
+* 使用者檢舉留言，管理者（admin / author）處理管轄範圍內留言的檢舉
+ */
+
+// 同一則留言被不同使用者檢舉達此次數時自動隱藏
+const defaultReportAutoHideThreshold = 3
+
+var errAlreadyReported = errors.New("已檢舉過此留言")
+
+// 檢舉處理方式
+const (
+	reportActionNone   = "none"
+	reportActionHide   = "hide"
+	reportActionDelete = "delete"
+)
+
+func ReportComment(c *gin.Context) {
+	commentID := c.Param("id")
+	var input struct {
+		Reason string `json:"reason" binding:"required"`
+		Note   string `json:"note" binding:"max=500"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil || !models.IsValidReportReason(input.Reason) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "參數錯誤"})
+		return
+	}
+
+	// 驗證使用者是否登入
+	user := c.MustGet("currentUser").(models.User)
+
+	// 檢查留言是否存在
+	var comment models.Comment
+	if err := models.DB.Scopes(models.VisibleTo(&user)).First(&comment, commentID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "留言不存在"})
+		return
+	}
+	if comment.IsOwnedBy(user.ID) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "無法檢舉自己的留言"})
+		return
+	}
+
+	report := models.CommentReport{
+		ReporterID: user.ID,
+		CommentID:  comment.ID,
+		Reason:     input.Reason,
+		Note:       input.Note,
+		Status:     models.ReportOpen,
+	}
+
+	autoHidden := false
+	err := models.DB.Transaction(func(tx *gorm.DB) error {
+		// 鎖定留言，同時送出的檢舉依序計數，門檻判斷不會因讀到舊的數量而漏掉；同時重新讀取審核狀態
+		if err := tx.Clauses(clause.Locking{Strength: "NO KEY UPDATE"}).First(&comment, comment.ID).Error; err != nil {
+			return err
+		}
+
+		// 每位使用者對同一則留言只能檢舉一次，同時送出的重複檢舉由唯一索引擋下
+		result := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&report)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errAlreadyReported
+		}
+
+		// 未處理的檢舉數達門檻時自動隱藏留言，等待管理員處理
+		var count int64
+		if err := tx.Model(&models.CommentReport{}).
+			Where("comment_id = ? AND status = ?", comment.ID, models.ReportOpen).
+			Count(&count).Error; err != nil {
+			return err
+		}
+		if count >= int64(config.GetEnvAsInt("REPORT_AUTO_HIDE_THRESHOLD", defaultReportAutoHideThreshold)) && comment.Status == models.CommentVisible {
+			autoHidden = true
+			return tx.Model(&comment).Updates(map[string]interface{}{"status": models.CommentHidden, "auto_hidden": true}).Error
+		}
+		return nil
+	})
+	if errors.Is(err, errAlreadyReported) {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "留言不存在"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "檢舉失敗", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":     "檢舉成功",
+		"report_id":   report.ID,
+		"auto_hidden": autoHidden,
+	})
+}
+
+// 列出管轄範圍內留言的檢舉，預設列出未處理的檢舉，依時間由新到舊
+// 分頁參數：limit, cursor（上一頁最後一筆的 id）
+func GetReports(c *gin.Context) {
+	user := c.MustGet("currentUser").(models.User)
+
+	status := c.DefaultQuery("status", models.ReportOpen)
+	switch status {
+	case models.ReportOpen, models.ReportResolved, models.ReportDismissed:
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "無效的檢舉狀態"})
+		return
+	}
+
+	limit := defaultPageLimit
+	if raw := c.Query("limit"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": errInvalidPageParams.Error()})
+			return
+		}
+		limit = min(n, maxPageLimit)
+	}
+
+	// 已刪除的留言仍可能有未處理的檢舉，一併列出
+	moderated, moderatedArgs := models.ModeratedCommentCondition("c", user)
+	query := models.DB.Where("status = ?", status).
+		Where("comment_id IN (SELECT c.id FROM comments c WHERE "+moderated+")", moderatedArgs...)
+	if commentID := c.Query("comment_id"); commentID != "" {
+		query = query.Where("comment_id = ?", commentID)
+	}
+	if cursor := c.Query("cursor"); cursor != "" {
+		id, err := strconv.ParseUint(cursor, 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": errInvalidPageParams.Error()})
+			return
+		}
+		query = query.Where("id < ?", id)
+	}
+
+	var reports []models.CommentReport
+	if err := query.Preload("Reporter").Preload("Comment", func(db *gorm.DB) *gorm.DB {
+		return db.Unscoped()
+	}).Preload("Comment.User").Order("id DESC").Limit(limit + 1).Find(&reports).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "查詢檢舉失敗", "details": err.Error()})
+		return
+	}
+
+	nextCursor := ""
+	if len(reports) > limit {
+		reports = reports[:limit]
+		nextCursor = strconv.FormatUint(uint64(reports[len(reports)-1].ID), 10)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":     "查詢成功",
+		"reports":     newReportResponses(reports),
+		"limit":       limit,
+		"next_cursor": nextCursor,
+		"has_more":    nextCursor != "",
+	})
+}
+
+// 處理檢舉：可同時隱藏或刪除被檢舉的留言，該留言其他未處理的檢舉一併結案
+func ResolveReport(c *gin.Context) {
+	var input struct {
+		Action string `json:"action"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "參數錯誤"})
+		return
+	}
+	if input.Action == "" {
+		input.Action = reportActionNone
+	}
+	switch input.Action {
+	case reportActionNone, reportActionHide, reportActionDelete:
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "無效的處理方式"})
+		return
+	}
+
+	user := c.MustGet("currentUser").(models.User)
+
+	report, ok := findOpenReport(c, user)
+	if !ok {
+		return
+	}
+
+	now := time.Now()
+	err := models.DB.Transaction(func(tx *gorm.DB) error {
+		switch input.Action {
+		case reportActionHide:
+			if err := tx.Model(&models.Comment{}).Where("id = ?", report.CommentID).
+				Updates(map[string]interface{}{"status": models.CommentHidden, "auto_hidden": false}).Error; err != nil {
+				return err
+			}
+		case reportActionDelete:
+			// 留言已被刪除時略過
+			var comment models.Comment
+			if err := tx.First(&comment, report.CommentID).Error; err == nil {
+				if err := models.SoftDeleteComment(tx, &comment); err != nil {
+					return err
+				}
+			} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+				return err
+			}
+		}
+
+		// 同一則留言的未處理檢舉一併結案
+		query := tx.Model(&models.CommentReport{}).Where("status = ?", models.ReportOpen)
+		if input.Action == reportActionNone {
+			query = query.Where("id = ?", report.ID)
+		} else {
+			query = query.Where("comment_id = ?", report.CommentID)
+		}
+		return query.Updates(map[string]interface{}{
+			"status":         models.ReportResolved,
+			"resolved_by_id": user.ID,
+			"resolved_at":    now,
+		}).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "處理檢舉失敗", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "已處理檢舉", "action": input.Action})
+}
+
+// 駁回檢舉：restore 為 true 時，將被自動隱藏的留言恢復顯示
+// 只恢復因檢舉自動隱藏、且沒有其他未處理檢舉的留言，管理員手動隱藏的留言維持隱藏
+func DismissReport(c *gin.Context) {
+	var input struct {
+		Restore bool `json:"restore"`
+	}
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "參數錯誤"})
+			return
+		}
+	}
+
+	user := c.MustGet("currentUser").(models.User)
+
+	report, ok := findOpenReport(c, user)
+	if !ok {
+		return
+	}
+
+	now := time.Now()
+	restored := false
+	err := models.DB.Transaction(func(tx *gorm.DB) error {
+		if input.Restore {
+			result := tx.Model(&models.Comment{}).
+				Where("id = ? AND status = ? AND auto_hidden", report.CommentID, models.CommentHidden).
+				Where("NOT EXISTS (SELECT 1 FROM comment_reports r WHERE r.comment_id = ? AND r.status = ? AND r.id <> ?)", report.CommentID, models.ReportOpen, report.ID).
+				Updates(map[string]interface{}{"status": models.CommentVisible, "auto_hidden": false})
+			if result.Error != nil {
+				return result.Error
+			}
+			restored = result.RowsAffected > 0
+		}
+		return tx.Model(&report).Updates(map[string]interface{}{
+			"status":         models.ReportDismissed,
+			"resolved_by_id": user.ID,
+			"resolved_at":    now,
+		}).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "駁回檢舉失敗", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "已駁回檢舉", "restored": restored})
+}
+
+// 查詢未處理的檢舉，找不到、不在管轄範圍內或已處理時直接回應錯誤
+func findOpenReport(c *gin.Context, user models.User) (models.CommentReport, bool) {
+	var report models.CommentReport
+	if err := models.DB.Preload("Comment", func(db *gorm.DB) *gorm.DB {
+		return db.Unscoped()
+	}).First(&report, c.Param("id")).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "檢舉不存在"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "查詢檢舉失敗", "details": err.Error()})
+		}
+		return report, false
+	}
+	// 確認被檢舉的留言在使用者的管轄範圍內
+	if !user.Moderates(report.Comment) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "無權限管理此檢舉"})
+		return report, false
+	}
+	if report.Status != models.ReportOpen {
+		c.JSON(http.StatusConflict, gin.H{"error": "檢舉已處理"})
+		return report, false
+	}
+	return report, true
+}
@@ -0,0 +1,174 @@
+package controllers
+
+import (
+	"messageboard/models"
+	"time"
+)
+
+/*
+* Response
+*
+* API 回應的資料格式，只列出允許公開的欄位
+* 回應一律經由這裡的轉換函數產生，不直接序列化 models，避免密碼雜湊、Email 等內部欄位外洩
+ */
+
+// 公開的使用者資料，用於留言、點讚與檢舉中的使用者
+type userProfile struct {
+	ID       uint   `json:"id"`
+	Username string `json:"username"`
+}
+
+// 目前登入使用者自己的帳號資料
+type accountResponse struct {
+	ID                uint       `json:"id"`
+	Username          string     `json:"username"`
+	Email             string     `json:"email"`
+	EmailVerified     bool       `json:"email_verified"`
+	RoleID            uint       `json:"role_id"`
+	PasswordChangedAt *time.Time `json:"password_changed_at"`
+	CreatedAt         time.Time  `json:"created_at"`
+}
+
+type commentResponse struct {
+	ID         uint         `json:"id"`
+	URL        string       `json:"url"`
+	SiteID     *uint        `json:"site_id"`
+	ParentID   *uint        `json:"parent_id"`
+	UserID     *uint        `json:"user_id"`              // 訪客留言與已刪除的留言為 nil
+	User       *userProfile `json:"user"`                 // 訪客留言與已刪除的留言為 nil
+	GuestName  string       `json:"guest_name,omitempty"` // 訪客顯示名稱
+	LikesCount int64        `json:"likes_count"`
+	Status     string       `json:"status"`
+	Content    string       `json:"content"`
+	CreatedAt  time.Time    `json:"created_at"`
+	DeletedAt  *time.Time   `json:"deleted_at"` // 已刪除但仍有回覆時以墓碑呈現
+}
+
+type likeResponse struct {
+	ID        uint        `json:"id"`
+	User      userProfile `json:"user"`
+	CreatedAt time.Time   `json:"created_at"`
+}
+
+type reportResponse struct {
+	ID           uint             `json:"id"`
+	Reporter     userProfile      `json:"reporter"`
+	CommentID    uint             `json:"comment_id"`
+	Comment      *commentResponse `json:"comment"` // 留言已永久刪除時為 nil
+	Reason       string           `json:"reason"`
+	Note         string           `json:"note"`
+	Status       string           `json:"status"`
+	ResolvedByID *uint            `json:"resolved_by_id"`
+	ResolvedAt   *time.Time       `json:"resolved_at"`
+	CreatedAt    time.Time        `json:"created_at"`
+}
+
+// 登入嘗試紀錄，供管理員稽核
+type loginAttemptResponse struct {
+	ID        uint      `json:"id"`
+	Email     string    `json:"email"`
+	UserID    *uint     `json:"user_id"` // 帳號不存在時為 nil
+	IP        string    `json:"ip"`
+	UserAgent string    `json:"user_agent"`
+	Result    string    `json:"result"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func newUserProfile(user models.User) userProfile {
+	return userProfile{ID: user.ID, Username: user.Username}
+}
+
+func newAccountResponse(user models.User) accountResponse {
+	return accountResponse{
+		ID:                user.ID,
+		Username:          user.Username,
+		Email:             user.Email,
+		EmailVerified:     user.EmailVerified,
+		RoleID:            user.RoleID,
+		PasswordChangedAt: user.PasswordChangedAt,
+		CreatedAt:         user.CreatedAt,
+	}
+}
+
+// 轉換留言（需先 Preload User 才會帶有使用者資料）
+// 公開列表需先呼叫 Redact，已刪除的留言才會以墓碑呈現
+func newCommentResponse(comment models.Comment) commentResponse {
+	response := commentResponse{
+		ID:         comment.ID,
+		URL:        comment.URL,
+		SiteID:     comment.SiteID,
+		ParentID:   comment.ParentID,
+		UserID:     comment.UserID,
+		GuestName:  comment.GuestName,
+		LikesCount: comment.LikesCount,
+		Status:     comment.Status,
+		Content:    comment.Content,
+		CreatedAt:  comment.CreatedAt,
+	}
+	if comment.UserID != nil && comment.User.ID != 0 {
+		profile := newUserProfile(comment.User)
+		response.User = &profile
+	}
+	if comment.IsDeleted() {
+		response.DeletedAt = &comment.DeletedAt.Time
+	}
+	return response
+}
+
+func newCommentResponses(comments []models.Comment) []commentResponse {
+	responses := make([]commentResponse, len(comments))
+	for i, comment := range comments {
+		responses[i] = newCommentResponse(comment)
+	}
+	return responses
+}
+
+func newLikeResponses(likes []models.CommentLike) []likeResponse {
+	responses := make([]likeResponse, len(likes))
+	for i, like := range likes {
+		responses[i] = likeResponse{
+			ID:        like.ID,
+			User:      newUserProfile(like.User),
+			CreatedAt: like.CreatedAt,
+		}
+	}
+	return responses
+}
+
+func newReportResponses(reports []models.CommentReport) []reportResponse {
+	responses := make([]reportResponse, len(reports))
+	for i, report := range reports {
+		responses[i] = reportResponse{
+			ID:           report.ID,
+			Reporter:     newUserProfile(report.Reporter),
+			CommentID:    report.CommentID,
+			Reason:       report.Reason,
+			Note:         report.Note,
+			Status:       report.Status,
+			ResolvedByID: report.ResolvedByID,
+			ResolvedAt:   report.ResolvedAt,
+			CreatedAt:    report.CreatedAt,
+		}
+		if report.Comment.ID != 0 {
+			comment := newCommentResponse(report.Comment)
+			responses[i].Comment = &comment
+		}
+	}
+	return responses
+}
+
+func newLoginAttemptResponses(attempts []models.LoginAttempt) []loginAttemptResponse {
+	responses := make([]loginAttemptResponse, len(attempts))
+	for i, attempt := range attempts {
+		responses[i] = loginAttemptResponse{
+			ID:        attempt.ID,
+			Email:     attempt.Email,
+			UserID:    attempt.UserID,
+			IP:        attempt.IP,
+			UserAgent: attempt.UserAgent,
+			Result:    attempt.Result,
+			CreatedAt: attempt.CreatedAt,
+		}
+	}
+	return responses
+}
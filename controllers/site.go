@@ -0,0 +1,258 @@
+package controllers
+
+import (
+	"messageboard/models"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+/*
+* Site
+*
+* ListSites, GetSite, CreateSite, UpdateSite, DeleteSite
+* 管理多個網站：網域、站長、通知信箱、審核設定與 CORS 允許來源
+ */
+
+// 網站設定的輸入欄位，未提供的欄位不變更
+type siteInput struct {
+	Domain          *string  `json:"domain"`
+	Name            *string  `json:"name"`
+	OwnerID         *uint    `json:"owner_id"`
+	NotifyEmail     *string  `json:"notify_email" binding:"omitempty,email"`
+	PreModeration   *bool    `json:"pre_moderation"`
+	GuestComments   *bool    `json:"guest_comments"`
+	GuestModeration *bool    `json:"guest_moderation"`
+	AllowedOrigins  []string `json:"allowed_origins"`
+	// 網址正規化設定，變更後需執行網址遷移指令合併既有留言串
+	URLTrailingSlash *string  `json:"url_trailing_slash"`
+	URLIgnoreQuery   *bool    `json:"url_ignore_query"`
+	URLStripParams   []string `json:"url_strip_params"`
+}
+
+// 列出使用者可管理的網站：admin 列出全部，站長列出自己的網站
+func ListSites(c *gin.Context) {
+	user := c.MustGet("currentUser").(models.User)
+
+	query := models.DB.Order("id ASC")
+	if !user.ModeratesAll() {
+		query = query.Where("owner_id = ?", user.ID)
+	}
+
+	var sites []models.Site
+	if err := query.Find(&sites).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "查詢網站失敗", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "查詢成功",
+		"sites":   sites,
+	})
+}
+
+func GetSite(c *gin.Context) {
+	site, ok := findManagedSite(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"message": "查詢成功",
+		"site":    site,
+	})
+}
+
+// 新增網站（僅限管理員），並將網址符合網域的既有留言歸入此網站
+func CreateSite(c *gin.Context) {
+	var input siteInput
+	if err := c.ShouldBindJSON(&input); err != nil || input.Domain == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "參數錯誤"})
+		return
+	}
+
+	user := c.MustGet("currentUser").(models.User)
+
+	// 預設由建立者擔任站長，訪客留言需經審核
+	site := models.Site{OwnerID: user.ID, GuestModeration: true, URLTrailingSlash: models.TrailingSlashStrip}
+	if !applySiteInput(c, &site, input, true) {
+		return
+	}
+
+	err := models.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&site).Error; err != nil {
+			return err
+		}
+		return models.AttachCommentsToSite(tx, site)
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "建立網站失敗", "details": err.Error()})
+		return
+	}
+	models.InvalidateSiteOrigins()
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "建立成功",
+		"site":    site,
+	})
+}
+
+// 更新網站設定：站長可修改自己的網站，變更網域與站長僅限管理員
+func UpdateSite(c *gin.Context) {
+	var input siteInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "參數錯誤"})
+		return
+	}
+
+	site, ok := findManagedSite(c)
+	if !ok {
+		return
+	}
+
+	user := c.MustGet("currentUser").(models.User)
+	if !applySiteInput(c, &site, input, user.ModeratesAll()) {
+		return
+	}
+
+	err := models.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(&site).Error; err != nil {
+			return err
+		}
+		return models.AttachCommentsToSite(tx, site)
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "更新網站失敗", "details": err.Error()})
+		return
+	}
+	models.InvalidateSiteOrigins()
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "更新成功",
+		"site":    site,
+	})
+}
+
+// 刪除網站（僅限管理員），網站仍有留言時不可刪除
+func DeleteSite(c *gin.Context) {
+	var site models.Site
+	if err := models.DB.First(&site, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "網站不存在"})
+		return
+	}
+
+	var count int64
+	if err := models.DB.Unscoped().Model(&models.Comment{}).Where("site_id = ?", site.ID).Count(&count).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "刪除網站失敗", "details": err.Error()})
+		return
+	}
+	if count > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "網站仍有留言，無法刪除"})
+		return
+	}
+
+	if err := models.DB.Delete(&site).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "刪除網站失敗", "details": err.Error()})
+		return
+	}
+	models.InvalidateSiteOrigins()
+
+	c.JSON(http.StatusOK, gin.H{"message": "刪除成功"})
+}
+
+// 查詢網站並確認使用者可管理，失敗時直接回應錯誤
+func findManagedSite(c *gin.Context) (models.Site, bool) {
+	user := c.MustGet("currentUser").(models.User)
+
+	var site models.Site
+	if err := models.DB.First(&site, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "網站不存在"})
+		return site, false
+	}
+	if !user.ManagesSite(site) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "無權限管理此網站"})
+		return site, false
+	}
+	return site, true
+}
+
+// 套用網站設定並驗證，admin 為 false 時不可變更網域與站長
+func applySiteInput(c *gin.Context, site *models.Site, input siteInput, admin bool) bool {
+	if (input.Domain != nil || input.OwnerID != nil) && !admin {
+		c.JSON(http.StatusForbidden, gin.H{"error": "僅管理員可變更網域與站長"})
+		return false
+	}
+
+	if input.Domain != nil {
+		domain := models.NormalizeDomain(*input.Domain)
+		if domain == "" || strings.ContainsAny(domain, "/?#@ ") {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "網域格式錯誤"})
+			return false
+		}
+		var count int64
+		models.DB.Model(&models.Site{}).Where("domain = ? AND id <> ?", domain, site.ID).Count(&count)
+		if count > 0 {
+			c.JSON(http.StatusConflict, gin.H{"error": "網域已被其他網站使用"})
+			return false
+		}
+		site.Domain = domain
+	}
+	if input.OwnerID != nil {
+		// 站長需具備審核權限，才能管理網站的留言
+		var owner models.User
+		if err := models.DB.Preload("Role").First(&owner, *input.OwnerID).Error; err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "站長不存在"})
+			return false
+		}
+		if !owner.HasPermission(models.PermCommentModerate) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "站長需具備審核權限"})
+			return false
+		}
+		site.OwnerID = owner.ID
+	}
+	if input.AllowedOrigins != nil {
+		origins := make([]string, 0, len(input.AllowedOrigins))
+		for _, origin := range input.AllowedOrigins {
+			u, err := url.Parse(strings.TrimSpace(origin))
+			if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || strings.Trim(u.Path, "/") != "" {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "來源格式錯誤：" + origin})
+				return false
+			}
+			origins = append(origins, u.Scheme+"://"+strings.ToLower(u.Host))
+		}
+		site.AllowedOrigins = origins
+	}
+
+	if input.URLTrailingSlash != nil {
+		if !models.IsValidTrailingSlash(*input.URLTrailingSlash) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "無效的結尾斜線設定"})
+			return false
+		}
+		site.URLTrailingSlash = *input.URLTrailingSlash
+	}
+	if input.URLIgnoreQuery != nil {
+		site.URLIgnoreQuery = *input.URLIgnoreQuery
+	}
+	if input.URLStripParams != nil {
+		site.URLStripParams = input.URLStripParams
+	}
+
+	if input.Name != nil {
+		site.Name = *input.Name
+	}
+	if input.NotifyEmail != nil {
+		site.NotifyEmail = *input.NotifyEmail
+	}
+	if input.PreModeration != nil {
+		site.PreModeration = *input.PreModeration
+	}
+	if input.GuestComments != nil {
+		site.GuestComments = *input.GuestComments
+	}
+	if input.GuestModeration != nil {
+		site.GuestModeration = *input.GuestModeration
+	}
+	return true
+}
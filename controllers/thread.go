@@ -0,0 +1,275 @@
+package controllers
+
+import (
+	"fmt"
+	"messageboard/models"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+/*
+* Thread
+*
+* GetCommentThread, GetCommentReplies
+* 以巢狀樹狀結構回傳留言串，子留言透過 Postgres recursive CTE 一次查出
+ */
+
+const (
+	defaultThreadDepth  = 3
+	maxThreadDepth      = 10
+	defaultRepliesLimit = 5
+	maxRepliesLimit     = 50
+)
+
+// 樹狀留言節點
+type threadNode struct {
+	commentResponse
+	Depth          int           `json:"depth"`
+	ReplyCount     int64         `json:"reply_count"`      // 直接回覆的總數
+	HasMoreReplies bool          `json:"has_more_replies"` // 是否還有未載入的回覆
+	NextCursor     string        `json:"next_cursor"`      // 傳給 GetCommentReplies 接續載入回覆
+	Replies        []*threadNode `json:"replies"`
+}
+
+type threadParams struct {
+	MaxDepth     int
+	RepliesLimit int
+}
+
+// 每個節點的樹狀資訊，由 recursive CTE 查出
+type threadRow struct {
+	ID         uint
+	ParentID   *uint
+	Depth      int
+	ReplyCount int64
+}
+
+// 以根留言為起點，每層每個父留言最多取 replies_limit 則回覆，深度不超過 max_depth
+// 已刪除且無回覆的留言不列出，%[1]s 為 models.ShownCommentCondition 產生的條件
+// 瀏覽者無權看見的留言也不列出，%[2]s 為 models.CommentVisibilityCondition 產生的條件
+const threadQuery = `
+WITH RECURSIVE thread AS (
+	SELECT c.id, c.parent_id, c.created_at, 0 AS depth
+	FROM comments c
+	WHERE c.id IN ?
+	UNION ALL
+	SELECT r.id, r.parent_id, r.created_at, t.depth + 1
+	FROM thread t
+	CROSS JOIN LATERAL (
+		SELECT c.id, c.parent_id, c.created_at
+		FROM comments c
+		WHERE c.parent_id = t.id AND ` + "%[1]s AND %[2]s" + `
+		ORDER BY c.created_at ASC, c.id ASC
+		LIMIT ?
+	) r
+	WHERE t.depth < ?
+)
+SELECT thread.id, thread.parent_id, thread.depth,
+	(SELECT COUNT(*) FROM comments c WHERE c.parent_id = thread.id AND ` + "%[1]s AND %[2]s" + `) AS reply_count
+FROM thread
+ORDER BY thread.depth ASC, thread.created_at ASC, thread.id ASC`
+
+func parseThreadParams(c *gin.Context) (threadParams, error) {
+	params := threadParams{MaxDepth: defaultThreadDepth, RepliesLimit: defaultRepliesLimit}
+
+	if raw := c.Query("max_depth"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 0 {
+			return params, errInvalidPageParams
+		}
+		params.MaxDepth = min(n, maxThreadDepth)
+	}
+	if raw := c.Query("replies_limit"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n <= 0 {
+			return params, errInvalidPageParams
+		}
+		params.RepliesLimit = min(n, maxRepliesLimit)
+	}
+
+	return params, nil
+}
+
+// 將一頁留言展開成樹狀結構，僅包含 viewer 可見的回覆
+func buildThread(roots []models.Comment, params threadParams, viewer *models.User) ([]*threadNode, error) {
+	nodes := make([]*threadNode, 0, len(roots))
+	if len(roots) == 0 {
+		return nodes, nil
+	}
+
+	rootIDs := make([]uint, len(roots))
+	for i, root := range roots {
+		rootIDs[i] = root.ID
+	}
+
+	var rows []threadRow
+	visibility, visibilityArgs := models.CommentVisibilityCondition("c", viewer)
+	query := fmt.Sprintf(threadQuery, models.ShownCommentCondition("c"), visibility)
+	args := []interface{}{rootIDs}
+	args = append(args, visibilityArgs...)
+	args = append(args, params.RepliesLimit, params.MaxDepth)
+	args = append(args, visibilityArgs...)
+	if err := models.DB.Raw(query, args...).Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	// 一次載入所有回覆的內容，避免 N+1 查詢
+	var replyIDs []uint
+	for _, row := range rows {
+		if row.Depth > 0 {
+			replyIDs = append(replyIDs, row.ID)
+		}
+	}
+	comments := make(map[uint]models.Comment, len(roots)+len(replyIDs))
+	for _, root := range roots {
+		comments[root.ID] = root
+	}
+	if len(replyIDs) > 0 {
+		var replies []models.Comment
+		if err := models.DB.Unscoped().Preload("User").Where("id IN ?", replyIDs).Find(&replies).Error; err != nil {
+			return nil, err
+		}
+		for _, reply := range replies {
+			reply.Redact()
+			comments[reply.ID] = reply
+		}
+	}
+
+	// rows 依深度排序，父節點必定先於子節點建立
+	byID := make(map[uint]*threadNode, len(rows))
+	for _, row := range rows {
+		comment, ok := comments[row.ID]
+		if !ok {
+			continue
+		}
+		node := &threadNode{
+			commentResponse: newCommentResponse(comment),
+			Depth:           row.Depth,
+			ReplyCount:      row.ReplyCount,
+			Replies:         []*threadNode{},
+		}
+		byID[row.ID] = node
+		if row.Depth > 0 && row.ParentID != nil {
+			if parent, ok := byID[*row.ParentID]; ok {
+				parent.Replies = append(parent.Replies, node)
+			}
+		}
+	}
+
+	for _, root := range roots {
+		node, ok := byID[root.ID]
+		if !ok {
+			continue
+		}
+		nodes = append(nodes, node)
+	}
+	// 回覆依時間由舊到新載入，與 GetCommentReplies 預設的 oldest 排序相同，可從最後一則回覆接續
+	for _, node := range byID {
+		node.HasMoreReplies = node.ReplyCount > int64(len(node.Replies))
+		if node.HasMoreReplies && len(node.Replies) > 0 {
+			last := node.Replies[len(node.Replies)-1]
+			node.NextCursor = encodeCursor(commentCursor{
+				Sort:       SortOldest,
+				CreatedAt:  last.CreatedAt,
+				LikesCount: last.LikesCount,
+				ID:         last.ID,
+			})
+		}
+	}
+
+	return nodes, nil
+}
+
+// 取得某網址的樹狀留言串，根留言依 cursor 分頁
+func GetCommentThread(c *gin.Context) {
+	url := c.Query("url")
+	if url == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "缺少 url 參數"})
+		return
+	}
+
+	params, err := parsePageParams(c, SortNewest)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	tp, err := parseThreadParams(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	viewer := currentViewer(c)
+	page, err := paginateComments(models.DB.Scopes(models.VisibleTo(viewer)).Where("url = ? AND parent_id IS NULL", queryURL(url)), params)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "查詢留言失敗: " + err.Error()})
+		return
+	}
+
+	nodes, err := buildThread(page.Comments, tp, viewer)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "查詢留言失敗: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":     "查詢成功",
+		"comments":    nodes,
+		"total":       page.Total,
+		"limit":       params.Limit,
+		"sort":        params.Sort,
+		"max_depth":   tp.MaxDepth,
+		"next_cursor": page.NextCursor,
+		"has_more":    page.NextCursor != "",
+	})
+}
+
+// 載入更多回覆：分頁取得某則留言的直接回覆，並展開其下層回覆
+// 可帶入樹狀節點的 next_cursor（預設 sort=oldest）接續載入
+func GetCommentReplies(c *gin.Context) {
+	commentID := c.Param("id")
+
+	viewer := currentViewer(c)
+	var parent models.Comment
+	if err := models.DB.Scopes(models.WithTombstones, models.VisibleTo(viewer)).First(&parent, commentID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "留言不存在"})
+		return
+	}
+
+	params, err := parsePageParams(c, SortOldest)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	tp, err := parseThreadParams(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	page, err := paginateComments(models.DB.Scopes(models.VisibleTo(viewer)).Where("parent_id = ?", parent.ID), params)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "查詢回覆失敗: " + err.Error()})
+		return
+	}
+
+	nodes, err := buildThread(page.Comments, tp, viewer)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "查詢回覆失敗: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":     "查詢成功",
+		"parent_id":   parent.ID,
+		"replies":     nodes,
+		"total":       page.Total,
+		"limit":       params.Limit,
+		"sort":        params.Sort,
+		"max_depth":   tp.MaxDepth,
+		"next_cursor": page.NextCursor,
+		"has_more":    page.NextCursor != "",
+	})
+}
@@ -1,9 +1,18 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
+	"messageboard/controllers"
 	"messageboard/models"
+	"messageboard/notifiers"
 	"messageboard/routers"
 )
 
@@ -20,11 +29,41 @@ func main() {
 		addr = ":8080"
 	}
 
+	// 收到中斷訊號時優雅關閉
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// 啟動通知寄送 worker
+	workerCtx, stopWorker := context.WithCancel(context.Background())
+	workerDone := make(chan struct{})
+	go func() {
+		defer close(workerDone)
+		notifiers.NewWorker(models.DB).Run(workerCtx)
+	}()
+	// 定期清除過期的登入嘗試紀錄
+	go controllers.RunLoginAttemptJanitor(workerCtx)
+
 	// 啟動服務
 	// 註冊路由
 	r := routers.SetupRouter()
 	// 設定監聽的端口
-	if err := r.Run(addr); err != nil {
-		panic(err)
+	srv := &http.Server{Addr: addr, Handler: r}
+	go func() {
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			panic(err)
+		}
+	}()
+
+	<-ctx.Done()
+	log.Println("正在關閉服務...")
+
+	// 先停止接收請求，再讓 worker 清空通知佇列
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		log.Printf("關閉服務失敗: %v\n", err)
 	}
+	stopWorker()
+	<-workerDone
+	log.Println("服務已關閉")
 }
@@ -0,0 +1,139 @@
+package middlewares
+
+import (
+	"net"
+	"net/http"
+	"net/netip"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 解析用戶端 IP：只有來自信任代理（TRUSTED_PROXIES）的請求才採用代理標頭，避免偽造
+// 只讀取 CLIENT_IP_HEADER 指定的一個標頭（代理實際設定的標頭），由右至左略過信任的代理，第一個不受信任的位址即為用戶端 IP
+// 不依序嘗試其他標頭：代理不會清除的標頭可由用戶端自行偽造
+// 解析結果寫回 Request.RemoteAddr，之後的 c.ClientIP()（限流、登入紀錄、防刷驗證、存取紀錄）都使用同一個結果
+func ResolveClientIP() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		host, port, err := net.SplitHostPort(c.Request.RemoteAddr)
+		if err != nil {
+			c.Next()
+			return
+		}
+		peer, err := netip.ParseAddr(host)
+		if err != nil {
+			c.Next()
+			return
+		}
+
+		if client := resolveClientIP(peer.Unmap(), c.Request.Header); client != peer {
+			c.Request.RemoteAddr = net.JoinHostPort(client.String(), port)
+		}
+		c.Next()
+	}
+}
+
+func resolveClientIP(peer netip.Addr, header http.Header) netip.Addr {
+	if !isTrustedProxy(peer) {
+		return peer
+	}
+
+	name := clientIPHeader()
+	chain := forwardedChain(name, header[name])
+	// 最右邊的位址由最接近本服務的代理加上
+	for i := len(chain) - 1; i >= 0; i-- {
+		addr, ok := parseForwardedAddr(chain[i])
+		if !ok {
+			break
+		}
+		if !isTrustedProxy(addr) || i == 0 {
+			return addr
+		}
+	}
+	return peer
+}
+
+// 取出標頭中依序經過的位址；Forwarded（RFC 7239）取各段的 for 參數，其餘標頭以逗號分隔
+func forwardedChain(name string, values []string) []string {
+	var chain []string
+	for _, value := range values {
+		for _, element := range strings.Split(value, ",") {
+			element = strings.TrimSpace(element)
+			if name != "Forwarded" {
+				if element != "" {
+					chain = append(chain, element)
+				}
+				continue
+			}
+			for _, pair := range strings.Split(element, ";") {
+				key, val, ok := strings.Cut(strings.TrimSpace(pair), "=")
+				if ok && strings.EqualFold(key, "for") {
+					chain = append(chain, strings.Trim(val, `"`))
+				}
+			}
+		}
+	}
+	return chain
+}
+
+// 解析位址，可帶有連接埠或 IPv6 的中括號（例如 Forwarded 的 "[2001:db8::1]:4711"）
+func parseForwardedAddr(value string) (netip.Addr, bool) {
+	if addr, err := netip.ParseAddr(value); err == nil {
+		return addr.Unmap(), true
+	}
+	if addrPort, err := netip.ParseAddrPort(value); err == nil {
+		return addrPort.Addr().Unmap(), true
+	}
+	if addr, err := netip.ParseAddr(strings.Trim(value, "[]")); err == nil {
+		return addr.Unmap(), true
+	}
+	return netip.Addr{}, false
+}
+
+// 讀取用戶端 IP 的代理標頭（CLIENT_IP_HEADER，預設 X-Forwarded-For）
+// 可設定為 Forwarded、X-Real-IP，使用 Cloudflare 時設定為 CF-Connecting-IP
+var clientIPHeader = sync.OnceValue(func() string {
+	name := strings.TrimSpace(os.Getenv("CLIENT_IP_HEADER"))
+	if name == "" {
+		name = "X-Forwarded-For"
+	}
+	return http.CanonicalHeaderKey(name)
+})
+
+// 信任的代理（TRUSTED_PROXIES，逗號分隔的 IP 或網段），未設定時不信任任何代理標頭
+var trustedProxies = sync.OnceValue(func() []netip.Prefix {
+	return parsePrefixList(os.Getenv("TRUSTED_PROXIES"))
+})
+
+func isTrustedProxy(addr netip.Addr) bool {
+	return prefixesContain(trustedProxies(), addr)
+}
+
+// 解析逗號分隔的 IP 或網段，單一 IP 視為完整長度的網段
+func parsePrefixList(value string) []netip.Prefix {
+	var prefixes []netip.Prefix
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		if prefix, err := netip.ParsePrefix(item); err == nil {
+			prefixes = append(prefixes, prefix.Masked())
+		} else if addr, err := netip.ParseAddr(item); err == nil {
+			addr = addr.Unmap()
+			prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+		}
+	}
+	return prefixes
+}
+
+func prefixesContain(prefixes []netip.Prefix, addr netip.Addr) bool {
+	for _, prefix := range prefixes {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
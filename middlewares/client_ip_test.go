@@ -0,0 +1,119 @@
+package middlewares
+
+import (
+	"net/http"
+	"net/netip"
+	"reflect"
+	"testing"
+)
+
+// 以固定的設定取代環境變數，測試結束後還原
+func withProxyConfig(t *testing.T, proxies, header string) {
+	t.Helper()
+	origProxies, origHeader := trustedProxies, clientIPHeader
+	trustedProxies = func() []netip.Prefix { return parsePrefixList(proxies) }
+	clientIPHeader = func() string { return http.CanonicalHeaderKey(header) }
+	t.Cleanup(func() {
+		trustedProxies, clientIPHeader = origProxies, origHeader
+	})
+}
+
+func TestResolveClientIP(t *testing.T) {
+	withProxyConfig(t, "10.0.0.0/8, 192.0.2.1", "X-Forwarded-For")
+
+	tests := []struct {
+		name   string
+		peer   string
+		header string
+		want   string
+	}{
+		{"untrusted peer ignores header", "198.51.100.7", "203.0.113.1", "198.51.100.7"},
+		{"trusted peer without header", "10.0.0.1", "", "10.0.0.1"},
+		{"single hop", "10.0.0.1", "203.0.113.1", "203.0.113.1"},
+		{"skips trusted proxies from the right", "10.0.0.1", "203.0.113.1, 192.0.2.1, 10.1.2.3", "203.0.113.1"},
+		{"spoofed left-most entry", "10.0.0.1", "1.1.1.1, 203.0.113.1", "203.0.113.1"},
+		{"all trusted uses left-most", "10.0.0.1", "10.0.0.2, 10.0.0.3", "10.0.0.2"},
+		{"invalid entry stops the walk", "10.0.0.1", "203.0.113.1, garbage", "10.0.0.1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header := http.Header{}
+			if tt.header != "" {
+				header.Set("X-Forwarded-For", tt.header)
+			}
+			got := resolveClientIP(netip.MustParseAddr(tt.peer), header)
+			if got != netip.MustParseAddr(tt.want) {
+				t.Fatalf("resolveClientIP() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestResolveClientIPForwarded(t *testing.T) {
+	withProxyConfig(t, "10.0.0.1", "forwarded")
+
+	header := http.Header{}
+	header.Set("Forwarded", `for="[2001:db8::1]:4711";proto=https, for=10.0.0.1`)
+	// 未設定的標頭即使存在也不採用
+	header.Set("X-Forwarded-For", "203.0.113.1")
+
+	got := resolveClientIP(netip.MustParseAddr("10.0.0.1"), header)
+	if want := netip.MustParseAddr("2001:db8::1"); got != want {
+		t.Fatalf("resolveClientIP() = %s, want %s", got, want)
+	}
+}
+
+func TestForwardedChain(t *testing.T) {
+	tests := []struct {
+		name   string
+		header string
+		values []string
+		want   []string
+	}{
+		{"comma separated", "X-Forwarded-For", []string{"1.1.1.1, 2.2.2.2", "3.3.3.3"}, []string{"1.1.1.1", "2.2.2.2", "3.3.3.3"}},
+		{"skips empty", "X-Forwarded-For", []string{"1.1.1.1,, "}, []string{"1.1.1.1"}},
+		{"forwarded for params", "Forwarded", []string{`for=1.1.1.1;proto=http, For="[::1]:80"`}, []string{"1.1.1.1", "[::1]:80"}},
+		{"forwarded without for", "Forwarded", []string{"proto=https;by=10.0.0.1"}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := forwardedChain(tt.header, tt.values); !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("forwardedChain() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseForwardedAddr(t *testing.T) {
+	tests := []struct {
+		value string
+		want  string
+		ok    bool
+	}{
+		{"203.0.113.1", "203.0.113.1", true},
+		{"203.0.113.1:8080", "203.0.113.1", true},
+		{"[2001:db8::1]:4711", "2001:db8::1", true},
+		{"[2001:db8::1]", "2001:db8::1", true},
+		{"::ffff:203.0.113.1", "203.0.113.1", true},
+		{"unknown", "", false},
+		{"_hidden", "", false},
+	}
+	for _, tt := range tests {
+		got, ok := parseForwardedAddr(tt.value)
+		if ok != tt.ok || (ok && got != netip.MustParseAddr(tt.want)) {
+			t.Errorf("parseForwardedAddr(%q) = %s, %v, want %s, %v", tt.value, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestParsePrefixList(t *testing.T) {
+	got := parsePrefixList(" 10.0.0.0/8, 192.0.2.1 ,, ::ffff:198.51.100.1, bogus")
+	want := []netip.Prefix{
+		netip.MustParsePrefix("10.0.0.0/8"),
+		netip.MustParsePrefix("192.0.2.1/32"),
+		netip.MustParsePrefix("198.51.100.1/32"),
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("parsePrefixList() = %v, want %v", got, want)
+	}
+}
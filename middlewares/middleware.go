@@ -4,7 +4,6 @@ import (
 	"errors"
 	"messageboard/models"
 	"net/http"
-	"os"
 	"strings"
 	"time"
 
@@ -15,68 +14,100 @@ import (
 // 身分驗中介軟體，使用 JWT 進行授權
 func JWTAuth() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		// 取得 Authorization 標頭
-		authHeader := c.GetHeader("Authorization")
-		if authHeader == "" || !strings.HasPrefix(authHeader, "Bearer ") {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "未提供授權資訊"})
+		user, err := authenticate(c)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
 			c.Abort()
 			return
 		}
 
-		// 取得 Token 字串
-		tokenString := strings.TrimPrefix(authHeader, "Bearer ")
+		// 更新使用者的最後登入時間
+		if err := models.DB.Model(&user).Update("last_login", time.Now()).Error; err != nil {
+			// 注意：這裡記錄錯誤可能比直接回傳 500 更好，避免影響主要流程
+			// log.Printf("更新最後登入時間失敗: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "更新最後登入時間失敗"})
+			c.Abort()
+			return
+		}
+
+		// 儲存至 context
+		c.Set("currentUser", user)
+		c.Next()
+	}
+}
 
-		// 解析 JWT Token
-		token, err := jwt.ParseWithClaims(tokenString, &models.AppClaims{}, func(token *jwt.Token) (interface{}, error) { // 使用 ParseWithClaims 和 struct 指標
-			// 驗證簽名方法
-			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-				return nil, jwt.ErrSignatureInvalid // 或更明確的錯誤
-			}
-			return []byte(os.Getenv("JWT_SECRET")), nil
-		})
+// 選擇性身分驗證，用於公開路由
+// 未帶 Token 時以訪客身分繼續；帶有 Token 但已過期或失效時回傳 401，避免以訪客身分送出
+func OptionalJWTAuth() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !strings.HasPrefix(c.GetHeader("Authorization"), "Bearer ") {
+			c.Next()
+			return
+		}
 
-		// 檢查解析錯誤和 Token 有效性
+		user, err := authenticate(c)
 		if err != nil {
-			// Use errors.Is for specific validation errors in v5
-			if errors.Is(err, jwt.ErrTokenMalformed) {
-				c.JSON(http.StatusUnauthorized, gin.H{"error": "Token 格式錯誤"})
-			} else if errors.Is(err, jwt.ErrTokenSignatureInvalid) { // Check signature invalidity specifically
-				c.JSON(http.StatusUnauthorized, gin.H{"error": "無效的簽名"})
-			} else if errors.Is(err, jwt.ErrTokenExpired) || errors.Is(err, jwt.ErrTokenNotValidYet) {
-				c.JSON(http.StatusUnauthorized, gin.H{"error": "Token 已過期或尚未生效"})
-			} else {
-				c.JSON(http.StatusUnauthorized, gin.H{"error": "無法處理 Token: " + err.Error()})
-			}
+			c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
 			c.Abort()
 			return
 		}
+		c.Set("currentUser", user)
+		c.Next()
+	}
+}
 
-		// 驗證 Token 的 Claims
-		if claims, ok := token.Claims.(*models.AppClaims); ok && token.Valid { // 斷言為 *models.AppClaims
-			// 取得使用者 ID，並查詢使用者資料
-			userID := claims.UserID // 直接從 struct 讀取，型別安全
-			var user models.User
-			if err := models.DB.First(&user, userID).Error; err != nil {
-				c.JSON(http.StatusUnauthorized, gin.H{"error": "用戶不存在"})
-				c.Abort()
-				return
-			}
-			// 更新使用者的最後登入時間
-			user.LastLogin = time.Now()
-			if err := models.DB.Save(&user).Error; err != nil {
-				// 注意：這裡記錄錯誤可能比直接回傳 500 更好，避免影響主要流程
-				// log.Printf("更新最後登入時間失敗: %v", err)
-				c.JSON(http.StatusInternalServerError, gin.H{"error": "更新最後登入時間失敗"})
-				c.Abort()
-				return
-			}
+// 解析 Authorization 標頭中的 JWT Token，並查詢對應的使用者
+func authenticate(c *gin.Context) (models.User, error) {
+	// 取得 Authorization 標頭
+	authHeader := c.GetHeader("Authorization")
+	if authHeader == "" || !strings.HasPrefix(authHeader, "Bearer ") {
+		return models.User{}, errors.New("未提供授權資訊")
+	}
 
-			// 儲存至 context
-			c.Set("currentUser", user)
-			c.Next()
-		} else {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "無效的 Token Claims"})
-			c.Abort()
+	// 取得 Token 字串
+	tokenString := strings.TrimPrefix(authHeader, "Bearer ")
+
+	// 解析 JWT Token
+	// 依 Token 的演算法與 kid 選擇驗證金鑰
+	token, err := models.ParseAppToken(tokenString)
+
+	// 檢查解析錯誤和 Token 有效性
+	if err != nil {
+		// Use errors.Is for specific validation errors in v5
+		if errors.Is(err, jwt.ErrTokenMalformed) {
+			return models.User{}, errors.New("Token 格式錯誤")
+		} else if errors.Is(err, jwt.ErrTokenSignatureInvalid) { // Check signature invalidity specifically
+			return models.User{}, errors.New("無效的簽名")
+		} else if errors.Is(err, jwt.ErrTokenExpired) || errors.Is(err, jwt.ErrTokenNotValidYet) {
+			return models.User{}, errors.New("Token 已過期或尚未生效")
+		}
+		return models.User{}, errors.New("無法處理 Token: " + err.Error())
+	}
+
+	// 驗證 Token 的 Claims
+	claims, ok := token.Claims.(*models.AppClaims) // 斷言為 *models.AppClaims
+	if !ok || !token.Valid {
+		return models.User{}, errors.New("無效的 Token Claims")
+	}
+
+	// 取得使用者 ID，並查詢使用者資料
+	var user models.User
+	if err := models.DB.Preload("Role").First(&user, claims.UserID).Error; err != nil { // 直接從 struct 讀取，型別安全
+		return models.User{}, errors.New("用戶不存在")
+	}
+
+	// 變更密碼後 Token 版本遞增，先前簽發的 Token 一律失效
+	if claims.Version != user.TokenVersion {
+		return models.User{}, errors.New("Token 已失效，請重新登入")
+	}
+
+	// 已登出或被撤銷的工作階段，其 Access Token 立即失效
+	if claims.SessionID != "" {
+		active, err := models.IsSessionFamilyActive(models.DB, claims.SessionID)
+		if err != nil || !active {
+			return models.User{}, errors.New("Token 已失效，請重新登入")
 		}
+		c.Set("sessionID", claims.SessionID)
 	}
+	return user, nil
 }
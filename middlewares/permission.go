@@ -0,0 +1,57 @@
+package middlewares
+
+import (
+	"messageboard/models"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 角色驗證中介軟體，需搭配 JWTAuth 使用
+// 使用者角色符合其中之一即可通過
+func RequireRole(roleNames ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, ok := currentUser(c)
+		if !ok {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "未提供授權資訊"})
+			c.Abort()
+			return
+		}
+		if !user.HasRole(roleNames...) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "權限不足"})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// 權限驗證中介軟體，需搭配 JWTAuth 使用
+// 使用者具備其中任一權限即可通過，資源擁有權仍需由 controller 檢查
+func RequirePermission(perms ...models.Permission) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, ok := currentUser(c)
+		if !ok {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "未提供授權資訊"})
+			c.Abort()
+			return
+		}
+		for _, perm := range perms {
+			if user.HasPermission(perm) {
+				c.Next()
+				return
+			}
+		}
+		c.JSON(http.StatusForbidden, gin.H{"error": "權限不足"})
+		c.Abort()
+	}
+}
+
+func currentUser(c *gin.Context) (models.User, bool) {
+	value, exists := c.Get("currentUser")
+	if !exists {
+		return models.User{}, false
+	}
+	user, ok := value.(models.User)
+	return user, ok
+}
@@ -1,7 +1,12 @@
 package middlewares
 
 import (
+	"log"
+	"math"
 	"net/http"
+	"net/netip"
+	"os"
+	"strconv"
 	"sync"
 	"time"
 
@@ -9,39 +14,99 @@ import (
 	"golang.org/x/time/rate"
 )
 
-type Client struct {
-	Limiter  *rate.Limiter
-	LastSeen time.Time
+// 限流規則：每分鐘允許的次數與突發上限
+// Name 用於區分各規則的限流狀態，同一個 key 在不同規則中分別計算
+type RateLimitPolicy struct {
+	Name      string
+	PerMinute float64
+	Burst     int
 }
 
-var clients = make(map[string]*Client)
-var mu sync.Mutex
+func (p RateLimitPolicy) limit() rate.Limit {
+	return rate.Limit(p.PerMinute / 60)
+}
 
-func getClient(ip string) *rate.Limiter {
-	mu.Lock()
-	defer mu.Unlock()
+// 額度完全恢復所需的時間，也是滑動時間窗的長度
+func (p RateLimitPolicy) window() time.Duration {
+	return tokenWait(float64(p.Burst), p.limit())
+}
 
-	if c, exists := clients[ip]; exists {
-		c.LastSeen = time.Now()
-		return c.Limiter
-	}
+// 不受限流的 IP 或網段（RATE_LIMIT_ALLOWLIST，逗號分隔，例如 127.0.0.1,10.0.0.0/8）
+var rateLimitAllowlist = sync.OnceValue(func() []netip.Prefix {
+	return parsePrefixList(os.Getenv("RATE_LIMIT_ALLOWLIST"))
+})
 
-	// 允許每秒 1 次，突發 3 次
-	limiter := rate.NewLimiter(1, 3)
-	clients[ip] = &Client{Limiter: limiter, LastSeen: time.Now()}
-	return limiter
+func isRateLimitExempt(c *gin.Context) bool {
+	addr, err := netip.ParseAddr(c.ClientIP())
+	if err != nil {
+		return false
+	}
+	return prefixesContain(rateLimitAllowlist(), addr.Unmap())
 }
 
-func RateLimitPerIP() gin.HandlerFunc {
+// 依 key 限流並設定 RateLimit-* 標頭，key 為空字串時不限流
+func rateLimit(policy RateLimitPolicy, key func(c *gin.Context) string) gin.HandlerFunc {
+	store := limiterStore()
 	return func(c *gin.Context) {
-		ip := c.ClientIP()
-		limiter := getClient(ip)
+		if isRateLimitExempt(c) {
+			c.Next()
+			return
+		}
+		k := key(c)
+		if k == "" {
+			c.Next()
+			return
+		}
+
+		decision, err := store.Take(policy, k, time.Now())
+		if err != nil {
+			// 限流狀態無法取得時不阻擋請求
+			log.Printf("限流失敗: %v\n", err)
+			c.Next()
+			return
+		}
+		c.Header("RateLimit-Limit", strconv.Itoa(decision.Limit))
+		c.Header("RateLimit-Remaining", strconv.Itoa(decision.Remaining))
+		c.Header("RateLimit-Reset", strconv.Itoa(ceilSeconds(decision.Reset)))
 
-		if !limiter.Allow() {
-			c.JSON(http.StatusTooManyRequests, gin.H{"error": "我不允許你 DDoS 我"})
+		if !decision.Allowed {
+			c.Header("Retry-After", strconv.Itoa(max(ceilSeconds(decision.RetryAfter), 1)))
+			c.JSON(http.StatusTooManyRequests, gin.H{"error": "操作太頻繁，請稍後再試"})
 			c.Abort()
 			return
 		}
 		c.Next()
 	}
 }
+
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
+
+// 依 IP 限流
+func RateLimitPerIP(policy RateLimitPolicy) gin.HandlerFunc {
+	return rateLimit(policy, func(c *gin.Context) string {
+		return c.ClientIP()
+	})
+}
+
+// 依登入使用者限流，需搭配 JWTAuth 使用
+func RateLimitPerUser(policy RateLimitPolicy) gin.HandlerFunc {
+	return rateLimit(policy, func(c *gin.Context) string {
+		user, ok := currentUser(c)
+		if !ok {
+			return ""
+		}
+		return strconv.FormatUint(uint64(user.ID), 10)
+	})
+}
+
+// 未登入訪客的額外 IP 限流，已登入的使用者直接通過，需搭配 OptionalJWTAuth 使用
+func RateLimitGuestPerIP(policy RateLimitPolicy) gin.HandlerFunc {
+	return rateLimit(policy, func(c *gin.Context) string {
+		if _, ok := currentUser(c); ok {
+			return ""
+		}
+		return c.ClientIP()
+	})
+}
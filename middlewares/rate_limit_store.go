@@ -0,0 +1,186 @@
+package middlewares
+
+import (
+	"log"
+	"math"
+	"messageboard/config"
+	"messageboard/models"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// 限流結果，用於產生 RateLimit-* 與 Retry-After 標頭
+type RateLimitDecision struct {
+	Allowed    bool
+	Limit      int
+	Remaining  int
+	Reset      time.Duration // 額度完全恢復所需時間
+	RetryAfter time.Duration // 被拒絕時，下一次可嘗試前需等待的時間
+}
+
+// 限流狀態的儲存方式，依 RATE_LIMIT_STORE 選擇
+// memory：保存在服務實例的記憶體中（預設）；postgres：多個服務實例共用資料庫中的計數
+type LimiterStore interface {
+	// 記錄一次請求並回傳是否允許
+	Take(policy RateLimitPolicy, key string, now time.Time) (RateLimitDecision, error)
+	// 清除不再影響限流結果的狀態，由 janitor 定期呼叫
+	Evict(idle time.Duration)
+}
+
+var limiterStore = sync.OnceValue(func() LimiterStore {
+	var store LimiterStore
+	switch strings.ToLower(os.Getenv("RATE_LIMIT_STORE")) {
+	case "postgres":
+		store = &PostgresLimiterStore{}
+	default:
+		store = NewMemoryLimiterStore()
+	}
+	go runLimiterJanitor(store, rateLimitIdleTTL())
+	return store
+})
+
+// 閒置多久的限流狀態會被清除（RATE_LIMIT_IDLE_TTL，預設 10 分鐘）
+func rateLimitIdleTTL() time.Duration {
+	return config.GetEnvAsDuration("RATE_LIMIT_IDLE_TTL", 10*time.Minute)
+}
+
+func runLimiterJanitor(store LimiterStore, idle time.Duration) {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+	for range ticker.C {
+		store.Evict(idle)
+	}
+}
+
+// 以 limit 的速率恢復 tokens 個額度所需的時間
+func tokenWait(tokens float64, limit rate.Limit) time.Duration {
+	if tokens <= 0 || limit <= 0 {
+		return 0
+	}
+	return time.Duration(tokens / float64(limit) * float64(time.Second))
+}
+
+type Client struct {
+	Limiter  *rate.Limiter
+	LastSeen time.Time
+	refill   time.Duration // 額度完全恢復所需的時間，閒置超過此時間才能清除
+}
+
+// 記憶體中的 token bucket 限流，依規則與 key（IP 或使用者 ID）保存各自的限流器
+type MemoryLimiterStore struct {
+	mu      sync.Mutex
+	clients map[string]*Client
+}
+
+func NewMemoryLimiterStore() *MemoryLimiterStore {
+	return &MemoryLimiterStore{clients: make(map[string]*Client)}
+}
+
+func (s *MemoryLimiterStore) Take(policy RateLimitPolicy, key string, now time.Time) (RateLimitDecision, error) {
+	s.mu.Lock()
+	c, exists := s.clients[policy.Name+":"+key]
+	if !exists {
+		c = &Client{Limiter: rate.NewLimiter(policy.limit(), policy.Burst), refill: policy.window()}
+		s.clients[policy.Name+":"+key] = c
+	}
+	c.LastSeen = now
+	s.mu.Unlock()
+
+	allowed := c.Limiter.AllowN(now, 1)
+	tokens := c.Limiter.TokensAt(now)
+
+	decision := RateLimitDecision{
+		Allowed:   allowed,
+		Limit:     policy.Burst,
+		Remaining: max(int(math.Floor(tokens)), 0),
+		Reset:     tokenWait(float64(policy.Burst)-tokens, policy.limit()),
+	}
+	if !allowed {
+		decision.RetryAfter = tokenWait(1-tokens, policy.limit())
+	}
+	return decision, nil
+}
+
+// 清除閒置超過 idle 的限流器，閒置期間額度早已恢復，重新建立不影響限流結果
+func (s *MemoryLimiterStore) Evict(idle time.Duration) {
+	now := time.Now()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for key, c := range s.clients {
+		if now.Sub(c.LastSeen) > max(idle, c.refill) {
+			delete(s.clients, key)
+		}
+	}
+}
+
+// 以資料庫計數的滑動時間窗限流，時間窗長度為額度完全恢復所需的時間，時間窗內最多允許 Burst 次
+// 目前時間窗的計數加上前一個時間窗依重疊比例加權的計數，即為滑動時間窗內的估計請求數
+type PostgresLimiterStore struct{}
+
+func (s *PostgresLimiterStore) Take(policy RateLimitPolicy, key string, now time.Time) (RateLimitDecision, error) {
+	window := policy.window()
+	if window <= 0 {
+		return RateLimitDecision{Allowed: true, Limit: policy.Burst, Remaining: policy.Burst}, nil
+	}
+	windowStart := now.Truncate(window)
+	elapsed := now.Sub(windowStart)
+
+	current, previous, err := models.IncrementRateLimit(models.DB, policy.Name, key, windowStart, window)
+	if err != nil {
+		return RateLimitDecision{}, err
+	}
+
+	limit := float64(policy.Burst)
+	weight := 1 - float64(elapsed)/float64(window)
+	estimate := float64(previous)*weight + float64(current)
+
+	decision := RateLimitDecision{
+		Allowed: estimate <= limit,
+		Limit:   policy.Burst,
+		Reset:   window - elapsed,
+	}
+	if current > 0 {
+		decision.Reset += window
+	}
+
+	if decision.Allowed {
+		decision.Remaining = max(int(math.Floor(limit-estimate)), 0)
+		return decision, nil
+	}
+
+	// 被拒絕的請求不計入，避免持續重試的用戶端永遠無法恢復
+	if err := models.DecrementRateLimit(models.DB, policy.Name, key, windowStart); err != nil {
+		log.Printf("限流計數回復失敗: %v\n", err)
+	}
+	current--
+	decision.RetryAfter = slidingWindowWait(float64(current), float64(previous), limit, elapsed, window)
+	return decision, nil
+}
+
+// 估計請求數降到可再允許一次請求所需的時間
+func slidingWindowWait(current, previous, limit float64, elapsed, window time.Duration) time.Duration {
+	if current+1 <= limit && previous > 0 {
+		// 前一個時間窗的權重隨時間遞減，在目前時間窗結束前即可恢復
+		needed := 1 - (limit-1-current)/previous
+		return max(time.Duration(needed*float64(window))-elapsed, 0)
+	}
+	// 目前時間窗已額滿，需等到下一個時間窗中，目前的計數權重降低
+	wait := window - elapsed
+	if current > 0 && limit > 1 {
+		wait += time.Duration((1 - (limit-1)/current) * float64(window))
+	} else if current > 0 {
+		wait += window
+	}
+	return wait
+}
+
+func (s *PostgresLimiterStore) Evict(time.Duration) {
+	if err := models.DeleteExpiredRateLimits(models.DB, time.Now()); err != nil {
+		log.Printf("清除限流計數失敗: %v\n", err)
+	}
+}
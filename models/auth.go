@@ -1,8 +1,77 @@
 package models
 
-import "github.com/golang-jwt/jwt/v5"
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"os"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
 
 type AppClaims struct {
-	UserID uint `json:"user_id"`
+	UserID    uint   `json:"user_id"`
+	Version   uint   `json:"ver,omitempty"` // 簽發時使用者的 Token 版本，需與 User.TokenVersion 相符
+	SessionID string `json:"sid,omitempty"` // 登入工作階段的 Family，登出後 Token 失效
 	jwt.RegisteredClaims
 }
+
+// Token 用途
+const (
+	PurposeUnsubscribe   = "unsubscribe"
+	PurposeVerifyEmail   = "verify_email"   // Scope 為驗證的 Email，變更 Email 後舊連結失效
+	PurposeResetPassword = "reset_password" // Scope 為目前密碼的指紋，重設密碼後舊連結失效（只能使用一次）
+)
+
+// 用途限定的 Token，例如 Email 中的取消訂閱連結
+// 各用途使用由 JWT_SECRET 衍生的不同金鑰簽署，無法當作登入 Token 使用
+type PurposeClaims struct {
+	UserID  uint   `json:"user_id"`
+	Purpose string `json:"purpose"`
+	Scope   string `json:"scope,omitempty"`
+	jwt.RegisteredClaims
+}
+
+var ErrInvalidPurposeToken = errors.New("無效或已過期的連結")
+
+// 簽署用途限定的 Token，ttl 為 0 表示不會過期
+func SignPurposeToken(userID uint, purpose, scope string, ttl time.Duration) (string, error) {
+	now := time.Now()
+	claims := PurposeClaims{
+		UserID:  userID,
+		Purpose: purpose,
+		Scope:   scope,
+		RegisteredClaims: jwt.RegisteredClaims{
+			IssuedAt: jwt.NewNumericDate(now),
+		},
+	}
+	if ttl > 0 {
+		claims.ExpiresAt = jwt.NewNumericDate(now.Add(ttl))
+	}
+	return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(purposeKey(purpose))
+}
+
+// 驗證用途限定的 Token，用途不符時視為無效
+func ParsePurposeToken(tokenString, purpose string) (*PurposeClaims, error) {
+	claims := &PurposeClaims{}
+	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		return purposeKey(purpose), nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}))
+	if err != nil || !token.Valid || claims.Purpose != purpose {
+		return nil, ErrInvalidPurposeToken
+	}
+	return claims, nil
+}
+
+// 密碼雜湊值的指紋，作為重設密碼 Token 的 Scope，密碼變更後指紋隨之改變
+func PasswordFingerprint(user User) string {
+	sum := sha256.Sum256([]byte(user.Password))
+	return hex.EncodeToString(sum[:8])
+}
+
+// 由 JWT_SECRET 與用途衍生簽章金鑰
+func purposeKey(purpose string) []byte {
+	key := sha256.Sum256([]byte(os.Getenv("JWT_SECRET") + ":" + purpose))
+	return key[:]
+}
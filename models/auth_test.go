@@ -0,0 +1,83 @@
+package models
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestPurposeTokenRoundTrip(t *testing.T) {
+	t.Setenv("JWT_SECRET", "test-secret")
+
+	token, err := SignPurposeToken(42, PurposeUnsubscribe, NotifyScopeLikes, 0)
+	if err != nil {
+		t.Fatalf("SignPurposeToken() error = %v", err)
+	}
+	claims, err := ParsePurposeToken(token, PurposeUnsubscribe)
+	if err != nil {
+		t.Fatalf("ParsePurposeToken() error = %v", err)
+	}
+	if claims.UserID != 42 || claims.Purpose != PurposeUnsubscribe || claims.Scope != NotifyScopeLikes {
+		t.Fatalf("ParsePurposeToken() = %+v", claims)
+	}
+	if claims.ExpiresAt != nil {
+		t.Fatalf("ExpiresAt = %v, want nil for ttl 0", claims.ExpiresAt)
+	}
+}
+
+func TestParsePurposeTokenInvalid(t *testing.T) {
+	t.Setenv("JWT_SECRET", "test-secret")
+
+	valid, err := SignPurposeToken(1, PurposeVerifyEmail, "user@example.com", time.Hour)
+	if err != nil {
+		t.Fatalf("SignPurposeToken() error = %v", err)
+	}
+	expired, err := jwt.NewWithClaims(jwt.SigningMethodHS256, PurposeClaims{
+		UserID:  1,
+		Purpose: PurposeVerifyEmail,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(-time.Minute)),
+		},
+	}).SignedString(purposeKey(PurposeVerifyEmail))
+	if err != nil {
+		t.Fatalf("SignedString() error = %v", err)
+	}
+
+	t.Setenv("JWT_SECRET", "other-secret")
+	otherSecret, err := SignPurposeToken(1, PurposeVerifyEmail, "user@example.com", time.Hour)
+	if err != nil {
+		t.Fatalf("SignPurposeToken() error = %v", err)
+	}
+	t.Setenv("JWT_SECRET", "test-secret")
+
+	tests := []struct {
+		name    string
+		token   string
+		purpose string
+	}{
+		{"wrong purpose", valid, PurposeResetPassword},
+		{"expired", expired, PurposeVerifyEmail},
+		{"different secret", otherSecret, PurposeVerifyEmail},
+		{"tampered", valid + "x", PurposeVerifyEmail},
+		{"malformed", "not-a-token", PurposeVerifyEmail},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ParsePurposeToken(tt.token, tt.purpose); !errors.Is(err, ErrInvalidPurposeToken) {
+				t.Fatalf("ParsePurposeToken() error = %v, want ErrInvalidPurposeToken", err)
+			}
+		})
+	}
+}
+
+func TestPasswordFingerprint(t *testing.T) {
+	a := PasswordFingerprint(User{Password: "hash-a"})
+	if a != PasswordFingerprint(User{Password: "hash-a"}) {
+		t.Fatal("PasswordFingerprint() is not deterministic")
+	}
+	if a == PasswordFingerprint(User{Password: "hash-b"}) {
+		t.Fatal("PasswordFingerprint() does not change with the password")
+	}
+}
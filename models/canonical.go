@@ -0,0 +1,200 @@
+package models
+
+import (
+	"errors"
+	"net/url"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// 網址結尾斜線的處理方式
+const (
+	TrailingSlashStrip = "strip" // 移除結尾斜線：/post/ → /post
+	TrailingSlashAdd   = "add"   // 補上結尾斜線：/post → /post/
+	TrailingSlashKeep  = "keep"  // 保留原樣
+)
+
+// 預設移除的追蹤參數，以 * 結尾表示前綴比對
+var defaultTrackingParams = []string{
+	"utm_*", "fbclid", "gclid", "dclid", "gbraid", "wbraid", "msclkid", "yclid",
+	"mc_cid", "mc_eid", "_ga", "_gl", "igshid", "ref", "ref_src", "spm",
+}
+
+var ErrInvalidCommentURL = errors.New("網址格式錯誤")
+
+// 網址正規化設定，由網站設定產生
+type CanonicalOptions struct {
+	TrailingSlash string   // 結尾斜線的處理方式，預設 strip
+	IgnoreQuery   bool     // 移除全部查詢參數
+	StripParams   []string // 額外移除的查詢參數，以 * 結尾表示前綴比對
+}
+
+func IsValidTrailingSlash(policy string) bool {
+	switch policy {
+	case TrailingSlashStrip, TrailingSlashAdd, TrailingSlashKeep:
+		return true
+	default:
+		return false
+	}
+}
+
+// 網站的網址正規化設定，site 為 nil 時使用預設值
+func CanonicalOptionsFor(site *Site) CanonicalOptions {
+	if site == nil {
+		return CanonicalOptions{TrailingSlash: TrailingSlashStrip}
+	}
+	return CanonicalOptions{
+		TrailingSlash: site.URLTrailingSlash,
+		IgnoreQuery:   site.URLIgnoreQuery,
+		StripParams:   site.URLStripParams,
+	}
+}
+
+// 將留言網址正規化，讓同一篇文章的不同寫法對應到同一個留言串：
+// scheme 與 host 轉小寫、移除預設連接埠與片段（#...）、移除追蹤參數並排序其餘參數、依設定處理結尾斜線
+func CanonicalizeURL(raw string, opts CanonicalOptions) (string, error) {
+	u, err := url.Parse(strings.TrimSpace(raw))
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return "", ErrInvalidCommentURL
+	}
+
+	u.Scheme = strings.ToLower(u.Scheme)
+	host := strings.TrimSuffix(strings.ToLower(u.Hostname()), ".")
+	port := u.Port()
+	if (u.Scheme == "http" && port == "80") || (u.Scheme == "https" && port == "443") {
+		port = ""
+	}
+	if strings.Contains(host, ":") {
+		host = "[" + host + "]" // IPv6
+	}
+	if port != "" {
+		host += ":" + port
+	}
+	u.Host = host
+	u.User = nil
+	u.Fragment = ""
+	u.RawFragment = ""
+
+	// 查詢參數：移除追蹤參數，其餘依名稱排序
+	if opts.IgnoreQuery {
+		u.RawQuery = ""
+	} else {
+		query := u.Query()
+		for name := range query {
+			if matchesParam(name, defaultTrackingParams) || matchesParam(name, opts.StripParams) {
+				query.Del(name)
+			}
+		}
+		u.RawQuery = query.Encode() // Encode 會依名稱排序
+	}
+	u.ForceQuery = false
+
+	// 路徑：空路徑視為根目錄，根目錄以外依設定處理結尾斜線
+	if u.Path == "" {
+		u.Path = "/"
+	}
+	if u.Path != "/" {
+		switch opts.TrailingSlash {
+		case TrailingSlashKeep:
+		case TrailingSlashAdd:
+			if !strings.HasSuffix(u.Path, "/") {
+				u.Path += "/"
+			}
+		default:
+			u.Path = strings.TrimRight(u.Path, "/")
+			if u.Path == "" {
+				u.Path = "/"
+			}
+		}
+	}
+	u.RawPath = ""
+
+	return u.String(), nil
+}
+
+// 檢查查詢參數名稱是否符合清單，以 * 結尾表示前綴比對
+func matchesParam(name string, patterns []string) bool {
+	name = strings.ToLower(name)
+	for _, pattern := range patterns {
+		pattern = strings.ToLower(strings.TrimSpace(pattern))
+		if prefix, ok := strings.CutSuffix(pattern, "*"); ok {
+			if strings.HasPrefix(name, prefix) {
+				return true
+			}
+		} else if name == pattern {
+			return true
+		}
+	}
+	return false
+}
+
+// 依網站設定正規化網址，並回傳網址所屬的網站（可能為 nil）
+func CanonicalizeCommentURL(db *gorm.DB, raw string) (string, *Site, error) {
+	site, err := FindSiteByURL(db, raw)
+	if err != nil {
+		return "", nil, err
+	}
+	canonical, err := CanonicalizeURL(raw, CanonicalOptionsFor(site))
+	if err != nil {
+		return "", nil, err
+	}
+	return canonical, site, nil
+}
+
+// 重新正規化既有留言的網址，讓原本分散的留言串合併
+// dryRun 為 true 時只統計不寫入，回傳需更新的留言數與合併後的網址數
+func RecanonicalizeCommentURLs(db *gorm.DB, dryRun bool) (updated int64, merged int, err error) {
+	var sites []Site
+	if err := db.Find(&sites).Error; err != nil {
+		return 0, 0, err
+	}
+	sitesByID := make(map[uint]*Site, len(sites))
+	for i := range sites {
+		sitesByID[sites[i].ID] = &sites[i]
+	}
+
+	// 逐一處理每個不同的網址，同一個網址只計算一次
+	var rows []struct {
+		URL    string
+		SiteID *uint
+	}
+	if err := db.Unscoped().Model(&Comment{}).Distinct("url", "site_id").Find(&rows).Error; err != nil {
+		return 0, 0, err
+	}
+
+	targets := make(map[string]bool)
+	for _, row := range rows {
+		var site *Site
+		if row.SiteID != nil {
+			site = sitesByID[*row.SiteID]
+		}
+		canonical, err := CanonicalizeURL(row.URL, CanonicalOptionsFor(site))
+		if err != nil || canonical == row.URL {
+			continue
+		}
+		targets[canonical] = true
+
+		query := db.Unscoped().Model(&Comment{}).Where("url = ?", row.URL)
+		if row.SiteID != nil {
+			query = query.Where("site_id = ?", *row.SiteID)
+		} else {
+			query = query.Where("site_id IS NULL")
+		}
+		if dryRun {
+			var count int64
+			if err := query.Count(&count).Error; err != nil {
+				return updated, 0, err
+			}
+			updated += count
+			continue
+		}
+		result := query.Update("url", canonical)
+		if result.Error != nil {
+			return updated, 0, result.Error
+		}
+		updated += result.RowsAffected
+	}
+
+	return updated, len(targets), nil
+}
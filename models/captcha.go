@@ -0,0 +1,28 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// 已通過驗證的 PoW 題目，多個服務實例共用，同一題只能通過一次
+type UsedChallenge struct {
+	ID        string    `gorm:"primaryKey"`     // 題目的 payload
+	ExpiresAt time.Time `gorm:"not null;index"` // 題目到期後即無法通過驗證，過期後由 janitor 清除
+}
+
+// 記錄題目已使用，題目先前已使用過時回傳 false
+func MarkChallengeUsed(db *gorm.DB, id string, expiresAt time.Time) (bool, error) {
+	result := db.Clauses(clause.OnConflict{DoNothing: true}).Create(&UsedChallenge{ID: id, ExpiresAt: expiresAt})
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected == 1, nil
+}
+
+// 清除已過期的題目紀錄
+func DeleteExpiredChallenges(db *gorm.DB, now time.Time) error {
+	return db.Where("expires_at < ?", now).Delete(&UsedChallenge{}).Error
+}
@@ -0,0 +1,203 @@
+package models
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// 已刪除但仍保留回覆的留言，以墓碑內容呈現
+const TombstoneContent = "[deleted]"
+
+// 留言審核狀態
+const (
+	CommentVisible = "visible" // 公開顯示
+	CommentHidden  = "hidden"  // 被管理者隱藏
+	CommentPending = "pending" // 等待審核
+	CommentSpam    = "spam"    // 垃圾留言
+)
+
+// 檢查是否為有效的審核狀態
+func IsValidCommentStatus(status string) bool {
+	switch status {
+	case CommentVisible, CommentHidden, CommentPending, CommentSpam:
+		return true
+	default:
+		return false
+	}
+}
+
+// 留言可被列出的條件：未刪除，或已刪除但仍有未刪除的子孫留言（以墓碑呈現）
+const shownCommentCondition = `(%[1]s.deleted_at IS NULL OR %[1]s.has_live_descendant)`
+
+// 產生指定資料表別名的留言列出條件
+func ShownCommentCondition(alias string) string {
+	return fmt.Sprintf(shownCommentCondition, alias)
+}
+
+// 查詢範圍：包含需以墓碑呈現的已刪除留言
+func WithTombstones(db *gorm.DB) *gorm.DB {
+	return db.Unscoped().Where(ShownCommentCondition("comments"))
+}
+
+// 產生留言可見性條件：管理者可看見管轄範圍內的全部留言，其他人只能看見公開的留言與自己的留言
+// viewer 為 nil 表示未登入的訪客
+func CommentVisibilityCondition(alias string, viewer *User) (string, []interface{}) {
+	switch {
+	case viewer != nil && viewer.HasPermission(PermCommentModerate) && viewer.ModeratesAll():
+		return "TRUE", nil
+	case viewer != nil && viewer.HasPermission(PermCommentModerate) && viewer.HasRole(RoleAuthor):
+		// 與 User.Moderates 相同：自己的網站與未歸屬網站的留言
+		return fmt.Sprintf("(%[1]s.status = ? OR %[1]s.user_id = ? OR %[1]s.site_id IS NULL OR %[1]s.site_id IN (SELECT id FROM sites WHERE owner_id = ?))", alias),
+			[]interface{}{CommentVisible, viewer.ID, viewer.ID}
+	case viewer != nil:
+		return fmt.Sprintf("(%[1]s.status = ? OR %[1]s.user_id = ?)", alias), []interface{}{CommentVisible, viewer.ID}
+	default:
+		return fmt.Sprintf("%s.status = ?", alias), []interface{}{CommentVisible}
+	}
+}
+
+// 產生管轄範圍條件，與 User.Moderates 相同：admin 管理全部留言，author 管理自己網站與未歸屬網站的留言
+func ModeratedCommentCondition(alias string, user User) (string, []interface{}) {
+	switch {
+	case user.ModeratesAll():
+		return "TRUE", nil
+	case user.HasRole(RoleAuthor):
+		return fmt.Sprintf("(%[1]s.site_id IS NULL OR %[1]s.site_id IN (SELECT id FROM sites WHERE owner_id = ?))", alias), []interface{}{user.ID}
+	default:
+		return "FALSE", nil
+	}
+}
+
+// 查詢範圍：僅包含 viewer 可見的留言
+func VisibleTo(viewer *User) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		condition, args := CommentVisibilityCondition("comments", viewer)
+		return db.Where(condition, args...)
+	}
+}
+
+// 是否為訪客留言
+func (c Comment) IsGuest() bool {
+	return c.UserID == nil
+}
+
+// 是否為指定使用者的留言
+func (c Comment) IsOwnedBy(userID uint) bool {
+	return c.UserID != nil && *c.UserID == userID
+}
+
+// 留言者的顯示名稱（需先 Preload User）
+func (c Comment) AuthorName() string {
+	if c.IsGuest() {
+		return c.GuestName
+	}
+	return c.User.Username
+}
+
+// 訪客編輯權杖只保存雜湊值
+func HashEditToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// 檢查訪客編輯權杖是否正確且仍在可編輯期限內
+func (c Comment) CanGuestEdit(token string, now time.Time) bool {
+	if !c.IsGuest() || c.EditToken == "" || token == "" || c.EditUntil == nil || now.After(*c.EditUntil) {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(c.EditToken), []byte(HashEditToken(token))) == 1
+}
+
+// 是否已被刪除
+func (c Comment) IsDeleted() bool {
+	return c.DeletedAt.Valid
+}
+
+// 將已刪除的留言轉為墓碑，隱藏內容與作者
+func (c *Comment) Redact() {
+	if !c.IsDeleted() {
+		return
+	}
+	c.Content = TombstoneContent
+	c.UserID = nil
+	c.User = User{}
+	c.GuestName = ""
+	c.Likes = nil
+}
+
+// 查詢以指定留言為根的整棵子樹（含已刪除的留言）
+func CommentSubtreeIDs(db *gorm.DB, rootID uint) ([]uint, error) {
+	var ids []uint
+	err := db.Raw(`
+		WITH RECURSIVE subtree AS (
+			SELECT id FROM comments WHERE id = ?
+			UNION ALL
+			SELECT c.id FROM comments c JOIN subtree ON c.parent_id = subtree.id
+		)
+		SELECT id FROM subtree`, rootID).Scan(&ids).Error
+	return ids, err
+}
+
+// 軟刪除留言並更新祖先留言的墓碑狀態，需在交易中呼叫
+func SoftDeleteComment(tx *gorm.DB, comment *Comment) error {
+	// 刪除前先鎖定留言與祖先，鎖定順序與其他更新一致，避免互相等待
+	if _, err := LockCommentChain(tx, comment.ID); err != nil {
+		return err
+	}
+	if err := tx.Delete(comment).Error; err != nil {
+		return err
+	}
+	return RefreshCommentAncestors(tx, comment.ParentID)
+}
+
+// 新增、刪除留言後，由 parentID 往上重新計算祖先留言的 has_live_descendant，需在同一個交易中呼叫
+// 某一層的結果未改變時，更上層也不受影響
+func RefreshCommentAncestors(tx *gorm.DB, parentID *uint) error {
+	if parentID == nil {
+		return nil
+	}
+	ancestors, err := LockCommentChain(tx, *parentID)
+	if err != nil {
+		return err
+	}
+
+	for _, id := range ancestors {
+		result := tx.Exec(`
+			UPDATE comments SET has_live_descendant = NOT has_live_descendant
+			WHERE id = ? AND has_live_descendant <> EXISTS (
+				SELECT 1 FROM comments ch WHERE ch.parent_id = comments.id AND (ch.deleted_at IS NULL OR ch.has_live_descendant)
+			)`, id)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			break
+		}
+	}
+	return nil
+}
+
+// 依 id 順序鎖定留言與其所有祖先（含已刪除的留言），同一串討論的墓碑狀態更新依序進行
+// 回傳由下而上的 id，第一個為留言本身；使用 FOR NO KEY UPDATE，不阻擋新增回覆時外鍵檢查的鎖
+func LockCommentChain(tx *gorm.DB, id uint) ([]uint, error) {
+	var chain []uint
+	if err := tx.Raw(`
+		WITH RECURSIVE chain AS (
+			SELECT id, parent_id, 0 AS depth FROM comments WHERE id = ?
+			UNION ALL
+			SELECT c.id, c.parent_id, chain.depth + 1 FROM comments c JOIN chain ON c.id = chain.parent_id
+		)
+		SELECT id FROM chain ORDER BY depth`, id).Scan(&chain).Error; err != nil {
+		return nil, err
+	}
+	if len(chain) == 0 {
+		return chain, nil
+	}
+	err := tx.Exec("SELECT id FROM comments WHERE id IN ? ORDER BY id FOR NO KEY UPDATE", chain).Error
+	return chain, err
+}
@@ -0,0 +1,79 @@
+package models
+
+import (
+	"errors"
+	"os"
+	"strings"
+)
+
+// 註冊 Email 網域的檢查結果
+var (
+	ErrEmailDomainDenied     = errors.New("此 Email 網域已被禁止註冊")
+	ErrEmailDomainNotAllowed = errors.New("此 Email 網域不在允許註冊的名單中")
+)
+
+// 網域名單：Allowed 為空時允許所有網域，Denied 優先於 Allowed
+// 名單項目可為完整網域（example.com）或萬用字元子網域（*.example.com，不含 example.com 本身）
+type DomainPolicy struct {
+	Allowed []string
+	Denied  []string
+}
+
+// 註冊 Email 網域名單，讀取 ALLOWED_DOMAINS 與 DENIED_DOMAINS（逗號分隔）
+func RegistrationDomainPolicy() DomainPolicy {
+	return DomainPolicy{
+		Allowed: splitDomainList(os.Getenv("ALLOWED_DOMAINS")),
+		Denied:  splitDomainList(os.Getenv("DENIED_DOMAINS")),
+	}
+}
+
+// 檢查 Email 的網域是否允許註冊
+func (p DomainPolicy) CheckEmail(email string) error {
+	at := strings.LastIndex(email, "@")
+	if at < 0 {
+		return ErrEmailDomainNotAllowed
+	}
+	domain := NormalizeDomain(email[at+1:])
+
+	if matchesDomainList(domain, p.Denied) {
+		return ErrEmailDomainDenied
+	}
+	if len(p.Allowed) > 0 && !matchesDomainList(domain, p.Allowed) {
+		return ErrEmailDomainNotAllowed
+	}
+	return nil
+}
+
+// 檢查網域是否符合名單中的任一項目
+func matchesDomainList(domain string, patterns []string) bool {
+	for _, pattern := range patterns {
+		if MatchDomain(domain, pattern) {
+			return true
+		}
+	}
+	return false
+}
+
+// 檢查網域是否符合名單項目，*.example.com 符合 example.com 的所有子網域
+func MatchDomain(domain, pattern string) bool {
+	if suffix, ok := strings.CutPrefix(pattern, "*."); ok {
+		return strings.HasSuffix(domain, "."+suffix)
+	}
+	return domain == pattern
+}
+
+func splitDomainList(value string) []string {
+	var domains []string
+	for _, item := range strings.Split(value, ",") {
+		item = strings.ToLower(strings.TrimSpace(item))
+		if item == "" {
+			continue
+		}
+		if suffix, ok := strings.CutPrefix(item, "*."); ok {
+			domains = append(domains, "*."+NormalizeDomain(suffix))
+		} else {
+			domains = append(domains, NormalizeDomain(item))
+		}
+	}
+	return domains
+}
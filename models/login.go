@@ -0,0 +1,148 @@
+package models
+
+import (
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// 登入嘗試紀錄，用於計算失敗次數（暴力破解防護）與稽核
+// 以 Email 而非使用者 ID 計算，不存在的帳號也會被鎖定，避免由回應差異判斷帳號是否存在
+type LoginAttempt struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	Email     string    `gorm:"not null;index:idx_login_attempt_email,priority:1" json:"email"` // 正規化後的 Email
+	UserID    *uint     `gorm:"index" json:"user_id"`                                           // 帳號存在時的使用者 ID
+	IP        string    `gorm:"not null;index:idx_login_attempt_ip,priority:1" json:"ip"`
+	UserAgent string    `json:"user_agent"`
+	Result    string    `gorm:"not null;index" json:"result"` // pending, success, failure, throttled
+	CreatedAt time.Time `gorm:"autoCreateTime;index;index:idx_login_attempt_email,priority:2;index:idx_login_attempt_ip,priority:2" json:"created_at"`
+}
+
+// 登入嘗試結果
+const (
+	LoginPending   = "pending" // 已通過檢查、正在驗證密碼，計入失敗次數直到更新結果
+	LoginSuccess   = "success"
+	LoginFailure   = "failure"   // 帳號不存在或密碼錯誤
+	LoginThrottled = "throttled" // 延遲或鎖定期間內的嘗試，不列入失敗次數
+)
+
+// 登入失敗的延遲與鎖定規則，帳號與 IP 分別計算
+// 失敗次數達 DelayAfter 後，每次需等待 BaseDelay 的倍數成長（上限 MaxDelay）才能再嘗試
+// 失敗次數達 MaxFailures 後鎖定 Lockout；帳號登入成功後重新計算，IP 則不因登入成功而重設
+type LoginPolicy struct {
+	Window        time.Duration // 計算失敗次數的期間
+	BaseDelay     time.Duration
+	MaxDelay      time.Duration
+	Lockout       time.Duration
+	DelayAfter    int
+	MaxFailures   int
+	IPDelayAfter  int
+	IPMaxFailures int
+}
+
+// 正規化登入 Email，作為計算失敗次數的依據
+func NormalizeLoginEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// 計入失敗次數的結果，尚未驗證完成的嘗試先視為失敗
+var countedLoginResults = []string{LoginFailure, LoginPending}
+
+// 在同一個交易中檢查並記錄登入嘗試，以 advisory lock 讓同一 Email 或 IP 的檢查依序進行，避免同時送出的多次嘗試都通過檢查
+// 需等待時記錄為 throttled 並回傳等待時間；可嘗試時記錄為 pending，驗證密碼後以 FinishLoginAttempt 更新結果
+func (p LoginPolicy) BeginAttempt(db *gorm.DB, attempt *LoginAttempt, now time.Time) (time.Duration, error) {
+	var wait time.Duration
+	err := db.Transaction(func(tx *gorm.DB) error {
+		// 固定先鎖 Email 再鎖 IP，避免互相等待
+		if err := tx.Exec("SELECT pg_advisory_xact_lock(hashtext(?)), pg_advisory_xact_lock(hashtext(?))",
+			"login_email:"+attempt.Email, "login_ip:"+attempt.IP).Error; err != nil {
+			return err
+		}
+
+		var err error
+		if wait, err = p.RetryAfter(tx, attempt.Email, attempt.IP, now); err != nil {
+			return err
+		}
+		attempt.Result = LoginPending
+		if wait > 0 {
+			attempt.Result = LoginThrottled
+		}
+		return tx.Create(attempt).Error
+	})
+	return wait, err
+}
+
+// 更新登入嘗試的結果與使用者
+func FinishLoginAttempt(db *gorm.DB, attempt *LoginAttempt, result string) error {
+	attempt.Result = result
+	return db.Model(attempt).Select("result", "user_id").Updates(attempt).Error
+}
+
+// 計算帳號與 IP 需等待多久才能再嘗試登入，0 表示可立即嘗試
+func (p LoginPolicy) RetryAfter(db *gorm.DB, email, ip string, now time.Time) (time.Duration, error) {
+	since := now.Add(-p.Retention())
+
+	type failureStats struct {
+		Failures    int
+		LastFailure *time.Time
+	}
+	var account, client failureStats
+
+	// 帳號：只計算最後一次登入成功之後的失敗
+	if err := db.Model(&LoginAttempt{}).
+		Select("COUNT(*) AS failures, MAX(created_at) AS last_failure").
+		Where("email = ? AND result IN ? AND created_at > ?", email, countedLoginResults, since).
+		Where("created_at > COALESCE((SELECT MAX(s.created_at) FROM login_attempts s WHERE s.email = ? AND s.result = ?), ?)", email, LoginSuccess, since).
+		Scan(&account).Error; err != nil {
+		return 0, err
+	}
+	if err := db.Model(&LoginAttempt{}).
+		Select("COUNT(*) AS failures, MAX(created_at) AS last_failure").
+		Where("ip = ? AND result IN ? AND created_at > ?", ip, countedLoginResults, since).
+		Scan(&client).Error; err != nil {
+		return 0, err
+	}
+
+	wait := max(
+		p.wait(account.Failures, account.LastFailure, p.DelayAfter, p.MaxFailures, now),
+		p.wait(client.Failures, client.LastFailure, p.IPDelayAfter, p.IPMaxFailures, now),
+	)
+	return wait, nil
+}
+
+func (p LoginPolicy) wait(failures int, lastFailure *time.Time, delayAfter, maxFailures int, now time.Time) time.Duration {
+	if lastFailure == nil {
+		return 0
+	}
+
+	var delay time.Duration
+	switch {
+	case maxFailures > 0 && failures >= maxFailures:
+		delay = p.Lockout
+	case delayAfter > 0 && failures >= delayAfter:
+		delay = p.BaseDelay
+		for i := delayAfter; i < failures && delay < p.MaxDelay; i++ {
+			delay *= 2
+		}
+		delay = min(delay, p.MaxDelay)
+	default:
+		return 0
+	}
+	return max(lastFailure.Add(delay).Sub(now), 0)
+}
+
+// 計算失敗次數需要的紀錄期間，更早的紀錄不影響登入限制
+func (p LoginPolicy) Retention() time.Duration {
+	return max(p.Window, p.Lockout)
+}
+
+// 清除早於 before 的登入嘗試紀錄
+func DeleteLoginAttemptsBefore(db *gorm.DB, before time.Time) error {
+	return db.Where("created_at < ?", before).Delete(&LoginAttempt{}).Error
+}
+
+// 記錄登入嘗試
+func RecordLoginAttempt(db *gorm.DB, attempt LoginAttempt) error {
+	return db.Create(&attempt).Error
+}
@@ -15,16 +15,27 @@ import (
 var DB *gorm.DB
 
 type Comment struct {
-	ID        uint          `gorm:"primaryKey" json:"id"`
-	URL       string        `gorm:"not null;index" json:"url"`                        // 留言的網址
-	ParentID  *uint         `json:"parent_id"`                                        // 外鍵	Parent
-	Parent    *Comment      `gorm:"foreignKey:ParentID;references:ID" json:"parent"`  // 父留言，一對多
-	Replies   []Comment     `gorm:"foreignKey:ParentID;references:ID" json:"replies"` // 子留言，一對多
-	UserID    uint          `gorm:"not null" json:"user_id"`                          // 外鍵
-	User      User          `gorm:"foreignKey:UserID" json:"user"`                    // 關聯
-	Likes     []CommentLike `gorm:"foreignKey:CommentID" json:"likes,omitempty"`
-	Content   string        `gorm:"not null" json:"content"`
-	CreatedAt time.Time     `gorm:"autoCreateTime" json:"created_at"`
+	ID                uint           `gorm:"primaryKey" json:"id"`
+	URL               string         `gorm:"not null;index" json:"url"`                        // 留言的網址
+	SiteID            *uint          `gorm:"index" json:"site_id"`                             // 外鍵: 所屬網站，未設定網站時為 nil
+	Site              *Site          `gorm:"foreignKey:SiteID" json:"-"`                       // 關聯
+	ParentID          *uint          `gorm:"index" json:"parent_id"`                           // 外鍵	Parent
+	Parent            *Comment       `gorm:"foreignKey:ParentID;references:ID" json:"parent"`  // 父留言，一對多
+	Replies           []Comment      `gorm:"foreignKey:ParentID;references:ID" json:"replies"` // 子留言，一對多
+	UserID            *uint          `json:"user_id"`                                          // 外鍵，訪客留言為 nil
+	User              User           `gorm:"foreignKey:UserID" json:"user"`                    // 關聯
+	GuestName         string         `json:"guest_name,omitempty"`                             // 訪客顯示名稱
+	GuestEmail        string         `json:"-"`                                                // 訪客信箱（可選，不公開）
+	EditToken         string         `json:"-"`                                                // 訪客編輯權杖的雜湊值
+	EditUntil         *time.Time     `json:"-"`                                                // 訪客可編輯、刪除的期限
+	Likes             []CommentLike  `gorm:"foreignKey:CommentID" json:"likes,omitempty"`
+	LikesCount        int64          `gorm:"not null;default:0;index" json:"likes_count"`  // 點讚數（反正規化，供排序使用）
+	Status            string         `gorm:"not null;default:visible;index" json:"status"` // 審核狀態：visible, hidden, pending, spam
+	AutoHidden        bool           `gorm:"not null;default:false" json:"-"`              // 因檢舉數達門檻而自動隱藏，管理員變更狀態後清除
+	HasLiveDescendant bool           `gorm:"not null;default:false" json:"-"`              // 子孫中有未刪除的留言，刪除後仍以墓碑列出（由 RefreshCommentAncestors 維護）
+	Content           string         `gorm:"not null" json:"content"`
+	CreatedAt         time.Time      `gorm:"autoCreateTime;index" json:"created_at"`
+	DeletedAt         gorm.DeletedAt `gorm:"index" json:"deleted_at"` // 軟刪除，有回覆時以墓碑呈現
 }
 
 type CommentLike struct {
@@ -37,15 +48,19 @@ type CommentLike struct {
 }
 
 type User struct {
-	ID        uint      `gorm:"primaryKey" json:"id"`
-	Username  string    `gorm:"not null" json:"username"`
-	Email     string    `gorm:"not null" json:"email"`
-	Password  string    `gorm:"not null" json:"password"`
-	RoleID    uint      `gorm:"not null" json:"role_id"`       // 外鍵
-	Role      Role      `gorm:"foreignKey:RoleID" json:"role"` // 關聯
-	LastLogin time.Time `json:"last_login"`
-	UpdatedAt time.Time `gorm:"autoUpdateTime" json:"updated_at"`
-	CreatedAt time.Time `gorm:"autoCreateTime" json:"created_at"`
+	ID                uint       `gorm:"primaryKey" json:"id"`
+	Username          string     `gorm:"not null" json:"username"`
+	Email             string     `gorm:"not null" json:"-"` // 不直接序列化，回應一律使用 controllers 中的回應格式
+	Password          string     `gorm:"not null" json:"-"`
+	EmailVerified     bool       `gorm:"not null;default:false" json:"email_verified"` // Email 是否已驗證
+	EmailVerifiedAt   *time.Time `json:"email_verified_at"`
+	TokenVersion      uint       `gorm:"not null;default:0" json:"-"` // 變更密碼時遞增，使先前簽發的 Token 失效
+	PasswordChangedAt *time.Time `json:"password_changed_at"`
+	RoleID            uint       `gorm:"not null" json:"role_id"`       // 外鍵
+	Role              Role       `gorm:"foreignKey:RoleID" json:"role"` // 關聯
+	LastLogin         time.Time  `json:"last_login"`
+	UpdatedAt         time.Time  `gorm:"autoUpdateTime" json:"updated_at"`
+	CreatedAt         time.Time  `gorm:"autoCreateTime" json:"created_at"`
 }
 
 type Role struct {
@@ -54,7 +69,8 @@ type Role struct {
 	CreatedAt time.Time `gorm:"autoCreateTime" json:"created_at"`
 }
 
-func InitDB() {
+// 連接資料庫，不建立資料表（供一次性的維護指令使用）
+func ConnectDB() {
 	// 載入 .env 檔案
 	err := godotenv.Load()
 	if err != nil {
@@ -82,19 +98,63 @@ func InitDB() {
 	}
 
 	log.Println("成功連接到資料庫")
+}
+
+// 初始化資料庫
+func InitDB() {
+	ConnectDB()
 
 	// 僅開發環境下 drop table
 	if os.Getenv("APP_ENV") == "dev" {
-		DB.Migrator().DropTable(&Comment{}, &User{}, &Role{}, &CommentLike{})
+		DB.Migrator().DropTable(&Comment{}, &Site{}, &Session{}, &User{}, &Role{}, &CommentLike{}, &CommentReport{}, &NotificationPreference{}, &OutboxMessage{}, &SigningKey{}, &LoginAttempt{}, &RateLimitCounter{}, &UsedChallenge{})
 		log.Println("已刪除舊資料表")
 	}
 
+	// 舊版資料表沒有點讚數欄位，建立後需回填
+	backfillLikes := DB.Migrator().HasTable(&Comment{}) && !DB.Migrator().HasColumn(&Comment{}, "LikesCount")
+	// 舊版資料表沒有墓碑欄位，建立後需回填
+	backfillTombstones := DB.Migrator().HasTable(&Comment{}) && !DB.Migrator().HasColumn(&Comment{}, "HasLiveDescendant")
+	// 舊版資料表沒有 Email 驗證欄位，既有的使用者視為已驗證
+	backfillVerified := DB.Migrator().HasTable(&User{}) && !DB.Migrator().HasColumn(&User{}, "EmailVerified")
+
 	// 自動建立資料表
-	if err := DB.AutoMigrate(&User{}, &Role{}, &Comment{}, &CommentLike{}); err != nil {
+	if err := DB.AutoMigrate(&User{}, &Role{}, &Session{}, &Site{}, &Comment{}, &CommentLike{}, &CommentReport{}, &NotificationPreference{}, &OutboxMessage{}, &SigningKey{}, &LoginAttempt{}, &RateLimitCounter{}, &UsedChallenge{}); err != nil {
 		log.Fatal("自動建立資料表失敗：", err)
 	}
 	log.Println("成功建立資料表")
 
+	if backfillLikes {
+		if err := DB.Exec("UPDATE comments SET likes_count = (SELECT COUNT(*) FROM comment_likes WHERE comment_likes.comment_id = comments.id)").Error; err != nil {
+			log.Fatal("回填點讚數失敗：", err)
+		}
+		log.Println("成功回填點讚數")
+	}
+
+	if backfillTombstones {
+		if err := DB.Exec(`
+			WITH RECURSIVE ancestors AS (
+				SELECT parent_id AS id FROM comments WHERE deleted_at IS NULL AND parent_id IS NOT NULL
+				UNION
+				SELECT c.parent_id FROM comments c JOIN ancestors ON c.id = ancestors.id WHERE c.parent_id IS NOT NULL
+			)
+			UPDATE comments SET has_live_descendant = TRUE WHERE id IN (SELECT id FROM ancestors)`).Error; err != nil {
+			log.Fatal("回填墓碑狀態失敗：", err)
+		}
+		log.Println("成功回填墓碑狀態")
+	}
+
+	if backfillVerified {
+		if err := DB.Exec("UPDATE users SET email_verified = TRUE, email_verified_at = NOW()").Error; err != nil {
+			log.Fatal("回填 Email 驗證狀態失敗：", err)
+		}
+		log.Println("成功回填 Email 驗證狀態")
+	}
+
+	// 檢查 JWT 簽章設定，非對稱演算法需先建立金鑰
+	if err := EnsureSigningKey(DB); err != nil {
+		log.Fatal("初始化 JWT 簽章金鑰失敗：", err)
+	}
+
 	// 初始化預設角色
 	InitRole()
 
@@ -134,6 +194,8 @@ func InitUser() {
 		Email:    os.Getenv("AUTHOR_EMAIL"),
 		Password: os.Getenv("AUTHOR_PASSWORD"),
 		RoleID:   3,
+		// 預設作者由站長設定，不需驗證 Email
+		EmailVerified: true,
 	}}
 
 	for _, user := range users {
@@ -0,0 +1,90 @@
+package models
+
+import (
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// 使用者的 Email 通知偏好，沒有資料時使用預設值
+type NotificationPreference struct {
+	ID            uint       `gorm:"primaryKey" json:"-"`
+	UserID        uint       `gorm:"not null;uniqueIndex" json:"user_id"` // 外鍵
+	NotifyReplies bool       `gorm:"not null" json:"replies"`             // 留言被回覆時通知
+	NotifyLikes   bool       `gorm:"not null" json:"likes"`               // 留言被點讚時通知
+	NotifyDigest  bool       `gorm:"not null" json:"digest"`              // 網站摘要通知
+	Locale        string     `json:"locale"`                              // 通知信語系，空白表示使用預設語系
+	LastDigestAt  *time.Time `json:"-"`                                   // 上次排程網站摘要的時間，由通知 worker 更新
+	UpdatedAt     time.Time  `gorm:"autoUpdateTime" json:"updated_at"`
+	CreatedAt     time.Time  `gorm:"autoCreateTime" json:"created_at"`
+}
+
+// 取消訂閱的範圍
+const (
+	NotifyScopeReplies = "replies"
+	NotifyScopeLikes   = "likes"
+	NotifyScopeDigest  = "digest"
+	NotifyScopeAll     = "all"
+)
+
+// 通知信支援的語系
+const (
+	LocaleZhTW = "zh-TW"
+	LocaleEn   = "en"
+)
+
+// 檢查是否為支援的語系
+func IsSupportedLocale(locale string) bool {
+	return locale == LocaleZhTW || locale == LocaleEn
+}
+
+// 預設通知偏好：接收回覆與點讚通知，不接收摘要
+func DefaultNotificationPreference(userID uint) NotificationPreference {
+	return NotificationPreference{
+		UserID:        userID,
+		NotifyReplies: true,
+		NotifyLikes:   true,
+		NotifyDigest:  false,
+	}
+}
+
+// 查詢使用者的通知偏好，尚未設定時回傳預設值
+func GetNotificationPreference(userID uint) (NotificationPreference, error) {
+	var pref NotificationPreference
+	err := DB.Where("user_id = ?", userID).First(&pref).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return DefaultNotificationPreference(userID), nil
+	}
+	return pref, err
+}
+
+// 是否接收指定範圍的通知
+func (p NotificationPreference) Allows(scope string) bool {
+	switch scope {
+	case NotifyScopeReplies:
+		return p.NotifyReplies
+	case NotifyScopeLikes:
+		return p.NotifyLikes
+	case NotifyScopeDigest:
+		return p.NotifyDigest
+	default:
+		return false
+	}
+}
+
+// 關閉指定範圍的通知，all 表示全部關閉
+func (p *NotificationPreference) Disable(scope string) {
+	switch scope {
+	case NotifyScopeReplies:
+		p.NotifyReplies = false
+	case NotifyScopeLikes:
+		p.NotifyLikes = false
+	case NotifyScopeDigest:
+		p.NotifyDigest = false
+	default:
+		p.NotifyReplies = false
+		p.NotifyLikes = false
+		p.NotifyDigest = false
+	}
+}
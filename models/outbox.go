@@ -0,0 +1,41 @@
+package models
+
+import "time"
+
+// 通知寄送佇列（outbox），與留言在同一個交易中寫入，由背景 worker 寄送
+type OutboxMessage struct {
+	ID              uint       `gorm:"primaryKey" json:"id"`
+	Channel         string     `gorm:"not null;default:smtp" json:"channel"`                                   // 通知管道：smtp, webhook, log
+	Event           string     `gorm:"not null" json:"event"`                                                  // 通知事件
+	CommentID       *uint      `gorm:"index" json:"comment_id"`                                                // 相關留言
+	RecipientUserID *uint      `json:"recipient_user_id"`                                                      // 收件者為使用者時的 ID，站長信箱為 nil
+	RecipientEmail  string     `gorm:"not null" json:"recipient_email"`                                        // 收件者信箱
+	Status          string     `gorm:"not null;default:pending;index:idx_outbox_due,priority:1" json:"status"` // 寄送狀態：pending, sent, skipped, dead
+	DedupeKey       *string    `gorm:"uniqueIndex:idx_outbox_dedupe,where:status = 'pending'" json:"-"`        // 同一個 key 同時只能有一筆待寄送的通知，以 ON CONFLICT DO NOTHING 寫入
+	Attempts        int        `gorm:"not null;default:0" json:"attempts"`                                     // 已嘗試次數
+	NextAttemptAt   time.Time  `gorm:"not null;index:idx_outbox_due,priority:2" json:"next_attempt_at"`        // 下次嘗試時間
+	LastError       string     `json:"last_error"`
+	SentAt          *time.Time `json:"sent_at"`
+	UpdatedAt       time.Time  `gorm:"autoUpdateTime" json:"updated_at"`
+	CreatedAt       time.Time  `gorm:"autoCreateTime" json:"created_at"`
+}
+
+// 通知事件
+const (
+	EventCommentCreated = "comment.created" // 新留言
+	EventCommentReply   = "comment.reply"   // 留言被回覆
+	EventCommentPending = "comment.pending" // 留言待審核
+	EventCommentLiked   = "comment.liked"   // 留言被點讚（彙整一段期間內的點讚）
+	EventSiteDigest     = "site.digest"     // 網站摘要（彙整一段期間內的新留言）
+
+	EventAccountVerifyEmail   = "account.verify_email"   // 驗證 Email（帳號通知，不受通知偏好影響）
+	EventAccountPasswordReset = "account.password_reset" // 重設密碼
+)
+
+// 寄送狀態
+const (
+	OutboxPending = "pending" // 等待寄送或重試
+	OutboxSent    = "sent"    // 已寄出
+	OutboxSkipped = "skipped" // 收件者已取消訂閱，不寄送
+	OutboxDead    = "dead"    // 超過重試次數或無法寄送
+)
@@ -0,0 +1,118 @@
+package models
+
+// 角色名稱，需與 InitRole 建立的資料一致
+const (
+	RoleReader = "reader"
+	RoleAdmin  = "admin"
+	RoleAuthor = "author"
+)
+
+type Permission string
+
+// 權限定義
+// own 結尾表示僅限自己的資源，any 結尾表示可操作管轄範圍內的所有資源
+const (
+	PermCommentCreate    Permission = "comment:create"
+	PermCommentLike      Permission = "comment:like"
+	PermCommentReport    Permission = "comment:report"
+	PermCommentUpdateOwn Permission = "comment:update:own"
+	PermCommentDeleteOwn Permission = "comment:delete:own"
+	PermCommentDeleteAny Permission = "comment:delete:any"
+	PermCommentModerate  Permission = "comment:moderate"
+)
+
+// 權限矩陣：角色 → 權限
+// admin 可刪除、隱藏任何留言；author 可管理自己網站的留言；reader 只能操作自己的留言
+var RolePermissions = map[string][]Permission{
+	RoleReader: {
+		PermCommentCreate,
+		PermCommentLike,
+		PermCommentReport,
+		PermCommentUpdateOwn,
+		PermCommentDeleteOwn,
+	},
+	RoleAuthor: {
+		PermCommentCreate,
+		PermCommentLike,
+		PermCommentReport,
+		PermCommentUpdateOwn,
+		PermCommentDeleteOwn,
+		PermCommentDeleteAny,
+		PermCommentModerate,
+	},
+	RoleAdmin: {
+		PermCommentCreate,
+		PermCommentLike,
+		PermCommentReport,
+		PermCommentUpdateOwn,
+		PermCommentDeleteOwn,
+		PermCommentDeleteAny,
+		PermCommentModerate,
+	},
+}
+
+// 檢查角色是否擁有指定權限
+func (r Role) HasPermission(perm Permission) bool {
+	for _, p := range RolePermissions[r.RoleName] {
+		if p == perm {
+			return true
+		}
+	}
+	return false
+}
+
+// 檢查使用者是否擁有指定權限（需先 Preload Role）
+func (u User) HasPermission(perm Permission) bool {
+	return u.Role.HasPermission(perm)
+}
+
+// 檢查使用者是否為指定角色之一（需先 Preload Role）
+func (u User) HasRole(roleNames ...string) bool {
+	for _, name := range roleNames {
+		if u.Role.RoleName == name {
+			return true
+		}
+	}
+	return false
+}
+
+// 檢查留言是否在使用者的管轄範圍內
+// admin 管理全部留言；author 管理自己網站的留言，未歸屬網站的留言沿用單一網站模式，由作者管理
+func (u User) Moderates(comment Comment) bool {
+	if u.ModeratesAll() {
+		return true
+	}
+	if !u.HasRole(RoleAuthor) {
+		return false
+	}
+	if comment.SiteID == nil {
+		return true
+	}
+	return u.OwnsSite(*comment.SiteID)
+}
+
+// 檢查使用者的管轄範圍是否涵蓋所有留言
+func (u User) ModeratesAll() bool {
+	return u.HasRole(RoleAdmin)
+}
+
+// 檢查使用者是否為網站的站長
+func (u User) OwnsSite(siteID uint) bool {
+	var count int64
+	DB.Model(&Site{}).Where("id = ? AND owner_id = ?", siteID, u.ID).Count(&count)
+	return count > 0
+}
+
+// 檢查使用者能否管理網站設定：admin 管理全部網站，站長管理自己的網站
+func (u User) ManagesSite(site Site) bool {
+	return u.ModeratesAll() || site.OwnerID == u.ID
+}
+
+// 檢查使用者能否對留言執行操作
+// 自己的留言需具備 own 權限；他人的留言需具備 any 權限且在管轄範圍內
+func (u User) CanManageComment(comment Comment, ownPerm, anyPerm Permission) bool {
+	if comment.IsOwnedBy(u.ID) && u.HasPermission(ownPerm) {
+		return true
+	}
+	return anyPerm != "" && u.HasPermission(anyPerm) && u.Moderates(comment)
+}
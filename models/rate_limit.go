@@ -0,0 +1,58 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// 限流計數（RATE_LIMIT_STORE=postgres 時使用），多個服務實例共用同一份限流狀態
+// 以固定長度的時間窗計數，查詢時加權前一個時間窗估算滑動時間窗內的請求數
+type RateLimitCounter struct {
+	Name        string    `gorm:"primaryKey"` // 限流規則
+	Key         string    `gorm:"primaryKey"` // IP 或使用者 ID
+	WindowStart time.Time `gorm:"primaryKey"`
+	Count       int64     `gorm:"not null;default:0"`
+	ExpiresAt   time.Time `gorm:"not null;index"` // 不再影響限流結果的時間，過期後由 janitor 清除
+}
+
+// 將目前時間窗的計數加一，回傳目前與前一個時間窗的計數
+func IncrementRateLimit(db *gorm.DB, name, key string, windowStart time.Time, window time.Duration) (current, previous int64, err error) {
+	counter := RateLimitCounter{
+		Name:        name,
+		Key:         key,
+		WindowStart: windowStart,
+		Count:       1,
+		ExpiresAt:   windowStart.Add(2 * window),
+	}
+	if err := db.Clauses(
+		clause.OnConflict{
+			Columns:   []clause.Column{{Name: "name"}, {Name: "key"}, {Name: "window_start"}},
+			DoUpdates: clause.Assignments(map[string]interface{}{"count": gorm.Expr("rate_limit_counters.count + 1")}),
+		},
+		clause.Returning{Columns: []clause.Column{{Name: "count"}}},
+	).Create(&counter).Error; err != nil {
+		return 0, 0, err
+	}
+
+	if err := db.Model(&RateLimitCounter{}).
+		Where("name = ? AND key = ? AND window_start = ?", name, key, windowStart.Add(-window)).
+		Select("COALESCE(SUM(count), 0)").
+		Scan(&previous).Error; err != nil {
+		return 0, 0, err
+	}
+	return counter.Count, previous, nil
+}
+
+// 被拒絕的請求不計入限流次數
+func DecrementRateLimit(db *gorm.DB, name, key string, windowStart time.Time) error {
+	return db.Model(&RateLimitCounter{}).
+		Where("name = ? AND key = ? AND window_start = ? AND count > 0", name, key, windowStart).
+		UpdateColumn("count", gorm.Expr("count - 1")).Error
+}
+
+// 清除已過期的限流計數
+func DeleteExpiredRateLimits(db *gorm.DB, now time.Time) error {
+	return db.Where("expires_at < ?", now).Delete(&RateLimitCounter{}).Error
+}
@@ -0,0 +1,44 @@
+package models
+
+import "time"
+
+type CommentReport struct {
+	ID           uint       `gorm:"primaryKey" json:"id"`
+	ReporterID   uint       `gorm:"not null;uniqueIndex:idx_reporter_comment" json:"reporter_id"`      // 外鍵: 檢舉人
+	Reporter     User       `gorm:"foreignKey:ReporterID" json:"reporter"`                             // 關聯
+	CommentID    uint       `gorm:"not null;uniqueIndex:idx_reporter_comment;index" json:"comment_id"` // 外鍵: 被檢舉的留言
+	Comment      Comment    `gorm:"foreignKey:CommentID" json:"comment"`                               // 關聯
+	Reason       string     `gorm:"not null" json:"reason"`                                            // 檢舉原因
+	Note         string     `json:"note"`                                                              // 補充說明
+	Status       string     `gorm:"not null;default:open;index" json:"status"`                         // 處理狀態：open, resolved, dismissed
+	ResolvedByID *uint      `json:"resolved_by_id"`                                                    // 外鍵: 處理的管理員
+	ResolvedAt   *time.Time `json:"resolved_at"`
+	CreatedAt    time.Time  `gorm:"autoCreateTime" json:"created_at"`
+}
+
+// 檢舉原因
+const (
+	ReportReasonSpam       = "spam"
+	ReportReasonHarassment = "harassment"
+	ReportReasonHate       = "hate"
+	ReportReasonSexual     = "sexual"
+	ReportReasonOffTopic   = "off_topic"
+	ReportReasonOther      = "other"
+)
+
+// 檢舉處理狀態
+const (
+	ReportOpen      = "open"
+	ReportResolved  = "resolved"
+	ReportDismissed = "dismissed"
+)
+
+// 檢查是否為有效的檢舉原因
+func IsValidReportReason(reason string) bool {
+	switch reason {
+	case ReportReasonSpam, ReportReasonHarassment, ReportReasonHate, ReportReasonSexual, ReportReasonOffTopic, ReportReasonOther:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,167 @@
+package models
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// 登入工作階段：每個 Refresh Token 一筆，輪替時撤銷舊的並建立新的
+// 同一次登入輪替出的 Refresh Token 屬於同一個 Family，登出或偵測到重複使用時整個 Family 一併撤銷
+type Session struct {
+	ID           uint       `gorm:"primaryKey" json:"id"`
+	UserID       uint       `gorm:"not null;index" json:"user_id"`   // 外鍵: 使用者
+	User         User       `gorm:"foreignKey:UserID" json:"-"`      // 關聯
+	FamilyID     string     `gorm:"not null;index" json:"family_id"` // 同一次登入的識別碼，放在 Access Token 的 sid
+	TokenHash    string     `gorm:"not null;uniqueIndex" json:"-"`   // Refresh Token 的雜湊值
+	ExpiresAt    time.Time  `gorm:"not null" json:"expires_at"`      // Refresh Token 到期時間
+	RevokedAt    *time.Time `json:"revoked_at"`                      // 撤銷（登出、輪替或重複使用）時間
+	ReplacedByID *uint      `json:"replaced_by_id"`                  // 輪替後的新工作階段
+	UserAgent    string     `json:"user_agent"`
+	IP           string     `json:"ip"`
+	CreatedAt    time.Time  `gorm:"autoCreateTime" json:"created_at"`
+}
+
+var (
+	ErrInvalidRefreshToken = errors.New("無效或已過期的 Refresh Token")
+	ErrRefreshTokenReused  = errors.New("Refresh Token 已被使用過，已登出此次登入的所有裝置")
+)
+
+// 是否仍可使用
+func (s Session) Active(now time.Time) bool {
+	return s.RevokedAt == nil && now.Before(s.ExpiresAt)
+}
+
+// 建立工作階段並回傳 Refresh Token 原文，資料庫只保存雜湊值
+// familyID 為空時開始新的登入
+func CreateSession(db *gorm.DB, userID uint, familyID, userAgent, ip string, ttl time.Duration) (Session, string, error) {
+	if familyID == "" {
+		id, err := randomToken(16)
+		if err != nil {
+			return Session{}, "", err
+		}
+		familyID = id
+	}
+	token, err := randomToken(32)
+	if err != nil {
+		return Session{}, "", err
+	}
+
+	session := Session{
+		UserID:    userID,
+		FamilyID:  familyID,
+		TokenHash: hashRefreshToken(token),
+		ExpiresAt: time.Now().Add(ttl),
+		UserAgent: userAgent,
+		IP:        ip,
+	}
+	if err := db.Create(&session).Error; err != nil {
+		return Session{}, "", err
+	}
+	return session, token, nil
+}
+
+// 輪替 Refresh Token：撤銷目前的工作階段並在同一個 Family 建立新的
+// 已撤銷的 Refresh Token 再次被使用時，視為外洩並撤銷整個 Family
+func RotateSession(db *gorm.DB, refreshToken, userAgent, ip string, ttl time.Duration) (Session, string, error) {
+	var next Session
+	var nextToken string
+	reusedFamily := ""
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var current Session
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("token_hash = ?", hashRefreshToken(refreshToken)).
+			First(&current).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrInvalidRefreshToken
+			}
+			return err
+		}
+
+		now := time.Now()
+		if current.RevokedAt != nil {
+			reusedFamily = current.FamilyID
+			return nil
+		}
+		if !current.Active(now) {
+			return ErrInvalidRefreshToken
+		}
+
+		var err error
+		next, nextToken, err = CreateSession(tx, current.UserID, current.FamilyID, userAgent, ip, ttl)
+		if err != nil {
+			return err
+		}
+		return tx.Model(&current).Updates(map[string]interface{}{
+			"revoked_at":     now,
+			"replaced_by_id": next.ID,
+		}).Error
+	})
+	if err != nil {
+		return Session{}, "", err
+	}
+
+	// 在交易外撤銷，避免回傳錯誤時一併回滾
+	if reusedFamily != "" {
+		if err := RevokeSessionFamily(db, reusedFamily); err != nil {
+			return Session{}, "", err
+		}
+		return Session{}, "", ErrRefreshTokenReused
+	}
+	return next, nextToken, nil
+}
+
+// 依 Refresh Token 查詢工作階段，找不到時回傳 ErrInvalidRefreshToken
+func FindSessionByRefreshToken(db *gorm.DB, refreshToken string) (Session, error) {
+	var session Session
+	if err := db.Where("token_hash = ?", hashRefreshToken(refreshToken)).First(&session).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return session, ErrInvalidRefreshToken
+		}
+		return session, err
+	}
+	return session, nil
+}
+
+// 撤銷同一次登入的所有工作階段
+func RevokeSessionFamily(db *gorm.DB, familyID string) error {
+	return db.Model(&Session{}).
+		Where("family_id = ? AND revoked_at IS NULL", familyID).
+		Update("revoked_at", time.Now()).Error
+}
+
+// 撤銷使用者所有的工作階段（變更密碼、登出所有裝置）
+func RevokeUserSessions(db *gorm.DB, userID uint) error {
+	return db.Model(&Session{}).
+		Where("user_id = ? AND revoked_at IS NULL", userID).
+		Update("revoked_at", time.Now()).Error
+}
+
+// 檢查登入是否仍有效：同一個 Family 中有未撤銷且未過期的工作階段
+func IsSessionFamilyActive(db *gorm.DB, familyID string) (bool, error) {
+	var count int64
+	err := db.Model(&Session{}).
+		Where("family_id = ? AND revoked_at IS NULL AND expires_at > ?", familyID, time.Now()).
+		Count(&count).Error
+	return count > 0, err
+}
+
+func hashRefreshToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func randomToken(size int) (string, error) {
+	buf := make([]byte, size)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
@@ -0,0 +1,379 @@
+package models
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"messageboard/config"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"gorm.io/gorm"
+)
+
+// 登入 Token 的簽章演算法，由 JWT_ALG 設定
+// HS256 使用 JWT_SECRET；RS256 與 EdDSA 使用資料庫中的金鑰，依排程輪替並以 kid 區分
+// 用途限定的 Token 與防刷驗證只在本服務內部使用，仍以 JWT_SECRET 衍生的金鑰簽署
+const (
+	AlgHS256 = "HS256"
+	AlgRS256 = "RS256"
+	AlgEdDSA = "EdDSA"
+)
+
+// 非對稱簽章金鑰，最新的一把負責簽署，已停用的金鑰在保留期間內仍可驗證並公開在 JWKS 中
+type SigningKey struct {
+	ID         uint          `gorm:"primaryKey" json:"id"`
+	Kid        string        `gorm:"not null;uniqueIndex" json:"kid"`
+	Algorithm  string        `gorm:"not null" json:"algorithm"`
+	PrivateKey string        `gorm:"type:text;not null" json:"-"` // PKCS#8 PEM
+	RetiredAt  *time.Time    `json:"retired_at"`                  // 停止簽署的時間
+	CreatedAt  time.Time     `gorm:"autoCreateTime" json:"created_at"`
+	signer     crypto.Signer `gorm:"-"`
+}
+
+var ErrUnknownSigningAlgorithm = errors.New("不支援的 JWT_ALG，可用的值為 HS256、RS256、EdDSA")
+
+// 目前設定的簽章演算法，未設定時為 HS256
+func SigningAlgorithm() (string, error) {
+	switch strings.ToUpper(strings.TrimSpace(os.Getenv("JWT_ALG"))) {
+	case "", "HS256":
+		return AlgHS256, nil
+	case "RS256":
+		return AlgRS256, nil
+	case "EDDSA", "ED25519":
+		return AlgEdDSA, nil
+	default:
+		return "", ErrUnknownSigningAlgorithm
+	}
+}
+
+// 金鑰輪替間隔：簽署中的金鑰超過此時間後產生新的金鑰
+func keyRotationInterval() time.Duration {
+	return config.GetEnvAsDuration("JWT_KEY_ROTATION", 30*24*time.Hour)
+}
+
+// 金鑰停用後仍可驗證的期間，需大於 Access Token 的有效期間
+func keyRetention() time.Duration {
+	return config.GetEnvAsDuration("JWT_KEY_RETENTION", 24*time.Hour)
+}
+
+// 檢查簽章設定，使用非對稱演算法時確保有可用的金鑰，於啟動時呼叫
+// 不論演算法皆需設定 JWT_SECRET：用途限定的 Token 與防刷驗證的題目都以它衍生的金鑰簽署
+func EnsureSigningKey(db *gorm.DB) error {
+	alg, err := SigningAlgorithm()
+	if err != nil {
+		return err
+	}
+	if os.Getenv("JWT_SECRET") == "" {
+		return errors.New("未設定 JWT_SECRET")
+	}
+	if alg == AlgHS256 {
+		return nil
+	}
+	_, err = activeSigningKey(db, alg)
+	return err
+}
+
+// 簽署登入 Token，非對稱演算法會在標頭帶上 kid
+func SignAppToken(claims AppClaims) (string, error) {
+	alg, err := SigningAlgorithm()
+	if err != nil {
+		return "", err
+	}
+	if alg == AlgHS256 {
+		return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(os.Getenv("JWT_SECRET")))
+	}
+
+	key, err := activeSigningKey(DB, alg)
+	if err != nil {
+		return "", err
+	}
+	token := jwt.NewWithClaims(jwt.GetSigningMethod(key.Algorithm), claims)
+	token.Header["kid"] = key.Kid
+	return token.SignedString(key.signer)
+}
+
+// 解析並驗證登入 Token
+func ParseAppToken(tokenString string) (*jwt.Token, error) {
+	return jwt.ParseWithClaims(tokenString, &AppClaims{}, appTokenKey,
+		jwt.WithValidMethods([]string{AlgHS256, AlgRS256, AlgEdDSA}))
+}
+
+// 依 Token 的演算法與 kid 取得驗證金鑰
+func appTokenKey(token *jwt.Token) (interface{}, error) {
+	if _, ok := token.Method.(*jwt.SigningMethodHMAC); ok {
+		// 只有設定為 HS256 時才接受 HMAC 簽章，避免以公開金鑰偽造 Token
+		if alg, err := SigningAlgorithm(); err != nil || alg != AlgHS256 {
+			return nil, jwt.ErrTokenSignatureInvalid
+		}
+		return hmacVerificationKeys(), nil
+	}
+
+	kid, _ := token.Header["kid"].(string)
+	key, ok := verificationKey(DB, kid)
+	if !ok || key.Algorithm != token.Method.Alg() {
+		return nil, jwt.ErrTokenSignatureInvalid
+	}
+	return key.signer.Public(), nil
+}
+
+// HS256 的驗證金鑰：JWT_SECRET 與輪替前的 JWT_PREVIOUS_SECRETS（逗號分隔）
+func hmacVerificationKeys() jwt.VerificationKeySet {
+	keys := jwt.VerificationKeySet{Keys: []jwt.VerificationKey{[]byte(os.Getenv("JWT_SECRET"))}}
+	for _, secret := range strings.Split(os.Getenv("JWT_PREVIOUS_SECRETS"), ",") {
+		if secret = strings.TrimSpace(secret); secret != "" {
+			keys.Keys = append(keys.Keys, []byte(secret))
+		}
+	}
+	return keys
+}
+
+// 公開金鑰（RFC 7517 JWK）
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n,omitempty"`   // RSA modulus
+	E   string `json:"e,omitempty"`   // RSA exponent
+	Crv string `json:"crv,omitempty"` // OKP curve
+	X   string `json:"x,omitempty"`   // OKP public key
+}
+
+// 可驗證登入 Token 的公開金鑰，包含保留期間內已停用的金鑰
+// 使用 HS256 且沒有保留中的非對稱金鑰時為空
+func PublicJWKs(db *gorm.DB) ([]JWK, error) {
+	if alg, err := SigningAlgorithm(); err == nil && alg != AlgHS256 {
+		if _, err := activeSigningKey(db, alg); err != nil {
+			return nil, err
+		}
+	}
+	keys, err := signingKeys.load(db, false)
+	if err != nil {
+		return nil, err
+	}
+
+	jwks := make([]JWK, 0, len(keys))
+	for _, key := range keys {
+		jwk := JWK{Kid: key.Kid, Use: "sig", Alg: key.Algorithm}
+		switch public := key.signer.Public().(type) {
+		case *rsa.PublicKey:
+			jwk.Kty = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(public.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes())
+		case ed25519.PublicKey:
+			jwk.Kty = "OKP"
+			jwk.Crv = "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(public)
+		default:
+			continue
+		}
+		jwks = append(jwks, jwk)
+	}
+	return jwks, nil
+}
+
+// 立即產生新的簽署金鑰，並停用目前的金鑰
+func RotateSigningKey(db *gorm.DB) (SigningKey, error) {
+	alg, err := SigningAlgorithm()
+	if err != nil {
+		return SigningKey{}, err
+	}
+	if alg == AlgHS256 {
+		return SigningKey{}, errors.New("HS256 不使用資料庫金鑰，請更換 JWT_SECRET 並將舊值加入 JWT_PREVIOUS_SECRETS")
+	}
+	key, err := rotateSigningKey(db, alg, true)
+	signingKeys.invalidate()
+	return key, err
+}
+
+// 取得簽署中的金鑰，超過輪替間隔或演算法變更時產生新的金鑰
+func activeSigningKey(db *gorm.DB, alg string) (SigningKey, error) {
+	keys, err := signingKeys.load(db, false)
+	if err != nil {
+		return SigningKey{}, err
+	}
+	for _, key := range keys {
+		if key.RetiredAt == nil && key.Algorithm == alg && time.Since(key.CreatedAt) < keyRotationInterval() {
+			return key, nil
+		}
+	}
+
+	key, err := rotateSigningKey(db, alg, false)
+	if err != nil {
+		return SigningKey{}, err
+	}
+	signingKeys.invalidate()
+	return key, nil
+}
+
+// 在交易中以 advisory lock 避免多個實例同時輪替；force 為 false 時，其他實例已輪替則直接使用
+func rotateSigningKey(db *gorm.DB, alg string, force bool) (SigningKey, error) {
+	var key SigningKey
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("SELECT pg_advisory_xact_lock(hashtext('signing_keys'))").Error; err != nil {
+			return err
+		}
+
+		now := time.Now()
+		var current SigningKey
+		err := tx.Where("retired_at IS NULL").Order("created_at DESC").First(&current).Error
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+		if err == nil && !force && current.Algorithm == alg && now.Sub(current.CreatedAt) < keyRotationInterval() {
+			key = current
+			return current.parse()
+		}
+
+		if err := tx.Model(&SigningKey{}).Where("retired_at IS NULL").Update("retired_at", now).Error; err != nil {
+			return err
+		}
+		// 超過保留期間的金鑰已無法驗證任何 Token，直接刪除
+		if err := tx.Where("retired_at < ?", now.Add(-keyRetention())).Delete(&SigningKey{}).Error; err != nil {
+			return err
+		}
+
+		generated, err := generateSigningKey(alg)
+		if err != nil {
+			return err
+		}
+		key = generated
+		return tx.Create(&key).Error
+	})
+	return key, err
+}
+
+// 產生新的金鑰，kid 為簽署開始的時間與隨機字串
+func generateSigningKey(alg string) (SigningKey, error) {
+	var private crypto.Signer
+	var err error
+	switch alg {
+	case AlgRS256:
+		private, err = rsa.GenerateKey(rand.Reader, 2048)
+	case AlgEdDSA:
+		_, private, err = ed25519.GenerateKey(rand.Reader)
+	default:
+		return SigningKey{}, ErrUnknownSigningAlgorithm
+	}
+	if err != nil {
+		return SigningKey{}, err
+	}
+
+	der, err := x509.MarshalPKCS8PrivateKey(private)
+	if err != nil {
+		return SigningKey{}, err
+	}
+	suffix, err := randomToken(6)
+	if err != nil {
+		return SigningKey{}, err
+	}
+	return SigningKey{
+		Kid:        time.Now().UTC().Format("20060102") + "-" + suffix,
+		Algorithm:  alg,
+		PrivateKey: string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})),
+		signer:     private,
+	}, nil
+}
+
+// 解析資料庫中的私鑰
+func (k *SigningKey) parse() error {
+	block, _ := pem.Decode([]byte(k.PrivateKey))
+	if block == nil {
+		return fmt.Errorf("金鑰 %s 格式錯誤", k.Kid)
+	}
+	private, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return fmt.Errorf("金鑰 %s 格式錯誤: %w", k.Kid, err)
+	}
+	signer, ok := private.(crypto.Signer)
+	if !ok {
+		return fmt.Errorf("金鑰 %s 格式錯誤", k.Kid)
+	}
+	k.signer = signer
+	return nil
+}
+
+// 依 kid 取得驗證金鑰；找不到時重新讀取一次，以取得其他實例剛輪替的金鑰
+func verificationKey(db *gorm.DB, kid string) (SigningKey, bool) {
+	if kid == "" {
+		return SigningKey{}, false
+	}
+	for _, reload := range []bool{false, true} {
+		keys, err := signingKeys.load(db, reload)
+		if err != nil {
+			return SigningKey{}, false
+		}
+		for _, key := range keys {
+			if key.Kid == kid {
+				return key, true
+			}
+		}
+	}
+	return SigningKey{}, false
+}
+
+// 金鑰快取，定期重新讀取以取得其他實例輪替的金鑰
+const (
+	signingKeysTTL         = time.Minute
+	signingKeysMinInterval = 5 * time.Second // 查無 kid 時強制重新讀取的最短間隔，避免被偽造的 kid 打爆資料庫
+)
+
+var signingKeys keyCache
+
+type keyCache struct {
+	mu       sync.RWMutex
+	keys     []SigningKey
+	loadedAt time.Time
+}
+
+// 讀取保留期間內的金鑰，新的在前
+func (c *keyCache) load(db *gorm.DB, reload bool) ([]SigningKey, error) {
+	c.mu.RLock()
+	age := time.Since(c.loadedAt)
+	if age < signingKeysTTL && (!reload || age < signingKeysMinInterval) {
+		keys := c.keys
+		c.mu.RUnlock()
+		return keys, nil
+	}
+	c.mu.RUnlock()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if age := time.Since(c.loadedAt); age < signingKeysMinInterval || (!reload && age < signingKeysTTL) {
+		return c.keys, nil
+	}
+
+	var keys []SigningKey
+	if err := db.Where("retired_at IS NULL OR retired_at >= ?", time.Now().Add(-keyRetention())).
+		Find(&keys).Error; err != nil {
+		return c.keys, err
+	}
+	for i := range keys {
+		if err := keys[i].parse(); err != nil {
+			return c.keys, err
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].CreatedAt.After(keys[j].CreatedAt) })
+
+	c.keys = keys
+	c.loadedAt = time.Now()
+	return keys, nil
+}
+
+func (c *keyCache) invalidate() {
+	c.mu.Lock()
+	c.loadedAt = time.Time{}
+	c.mu.Unlock()
+}
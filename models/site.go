@@ -0,0 +1,164 @@
+package models
+
+import (
+	"errors"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// 網站：同一個後端可服務多個網站，留言、通知與審核設定依網站區分
+type Site struct {
+	ID               uint      `gorm:"primaryKey" json:"id"`
+	Domain           string    `gorm:"not null;uniqueIndex" json:"domain"`                // 網站網域（小寫、不含連接埠），依留言網址的 host 比對
+	Name             string    `json:"name"`                                              // 顯示名稱
+	OwnerID          uint      `gorm:"not null;index" json:"owner_id"`                    // 外鍵: 站長
+	Owner            User      `gorm:"foreignKey:OwnerID" json:"-"`                       // 關聯
+	NotifyEmail      string    `json:"notify_email"`                                      // 站長通知信箱，未設定時使用 MAIL_TO
+	PreModeration    bool      `gorm:"not null;default:false" json:"pre_moderation"`      // 一般讀者的留言需經審核
+	GuestComments    bool      `gorm:"not null;default:false" json:"guest_comments"`      // 開啟訪客留言
+	GuestModeration  bool      `gorm:"not null" json:"guest_moderation"`                  // 訪客留言需經審核（建立時預設開啟）
+	AllowedOrigins   []string  `gorm:"serializer:json;type:text" json:"allowed_origins"`  // CORS 允許的來源，未設定時允許 https://{domain}
+	URLTrailingSlash string    `gorm:"not null;default:strip" json:"url_trailing_slash"`  // 網址正規化：結尾斜線的處理方式（strip, add, keep）
+	URLIgnoreQuery   bool      `gorm:"not null;default:false" json:"url_ignore_query"`    // 網址正規化：移除全部查詢參數
+	URLStripParams   []string  `gorm:"serializer:json;type:text" json:"url_strip_params"` // 網址正規化：額外移除的查詢參數，以 * 結尾表示前綴比對
+	UpdatedAt        time.Time `gorm:"autoUpdateTime" json:"updated_at"`
+	CreatedAt        time.Time `gorm:"autoCreateTime" json:"created_at"`
+}
+
+// 正規化網域：轉小寫並去除連接埠與結尾的點
+func NormalizeDomain(domain string) string {
+	domain = strings.ToLower(strings.TrimSpace(domain))
+	if u, err := url.Parse("//" + domain); err == nil && u.Hostname() != "" {
+		domain = u.Hostname()
+	}
+	return strings.TrimSuffix(domain, ".")
+}
+
+// 網站允許的 CORS 來源
+func (s Site) Origins() []string {
+	if len(s.AllowedOrigins) > 0 {
+		return s.AllowedOrigins
+	}
+	return []string{"https://" + s.Domain}
+}
+
+// 檢查來源是否為網站允許的 CORS 來源
+func (s Site) AllowsOrigin(origin string) bool {
+	origin = strings.TrimSuffix(strings.ToLower(origin), "/")
+	for _, allowed := range s.Origins() {
+		if strings.TrimSuffix(strings.ToLower(allowed), "/") == origin {
+			return true
+		}
+	}
+	return false
+}
+
+// 依留言網址的 host 查詢所屬網站，找不到時回傳 nil
+func FindSiteByURL(db *gorm.DB, rawURL string) (*Site, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Hostname() == "" {
+		return nil, nil
+	}
+	var site Site
+	err = db.Where("domain = ?", NormalizeDomain(u.Hostname())).Limit(1).Find(&site).Error
+	if err != nil || site.ID == 0 {
+		return nil, err
+	}
+	return &site, nil
+}
+
+var ErrCommentHostNotAllowed = errors.New("此網址不屬於任何已設定的網站")
+
+// 檢查留言網址是否屬於允許的網站，site 為 FindSiteByURL 的查詢結果
+// 已設定網站時，網址需屬於其中一個網站；尚未設定任何網站時，網址的 host 需符合 ALLOWED_ORIGINS（未設定時不限制）
+func CheckCommentHost(db *gorm.DB, rawURL string, site *Site) error {
+	if site != nil {
+		return nil
+	}
+
+	var count int64
+	if err := db.Model(&Site{}).Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return ErrCommentHostNotAllowed
+	}
+
+	origins := os.Getenv("ALLOWED_ORIGINS")
+	if origins == "" {
+		return nil
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return ErrCommentHostNotAllowed
+	}
+	host := NormalizeDomain(u.Hostname())
+	for _, origin := range strings.Split(origins, ",") {
+		o, err := url.Parse(strings.TrimSpace(origin))
+		if err == nil && NormalizeDomain(o.Hostname()) == host {
+			return nil
+		}
+	}
+	return ErrCommentHostNotAllowed
+}
+
+// 擷取網址 host 的 Postgres 正規表示式
+const urlHostPattern = `^[A-Za-z][A-Za-z0-9+.-]*://(?:[^@/]*@)?([^/:?#]+)`
+
+// 將尚未歸屬網站、網址 host 符合網域的既有留言歸入網站
+func AttachCommentsToSite(db *gorm.DB, site Site) error {
+	return db.Exec("UPDATE comments SET site_id = ? WHERE site_id IS NULL AND lower(substring(url from ?)) = ?",
+		site.ID, urlHostPattern, site.Domain).Error
+}
+
+// 所有網站允許的 CORS 來源，快取一段時間避免每個請求都查詢資料庫
+var siteOrigins struct {
+	mu        sync.RWMutex
+	origins   map[string]bool
+	expiresAt time.Time
+}
+
+const siteOriginsTTL = time.Minute
+
+// 檢查來源是否為任一網站允許的 CORS 來源
+func IsSiteOrigin(origin string) bool {
+	origin = strings.TrimSuffix(strings.ToLower(origin), "/")
+
+	siteOrigins.mu.RLock()
+	if time.Now().Before(siteOrigins.expiresAt) {
+		allowed := siteOrigins.origins[origin]
+		siteOrigins.mu.RUnlock()
+		return allowed
+	}
+	siteOrigins.mu.RUnlock()
+
+	siteOrigins.mu.Lock()
+	defer siteOrigins.mu.Unlock()
+	if time.Now().After(siteOrigins.expiresAt) {
+		var sites []Site
+		if err := DB.Find(&sites).Error; err != nil {
+			return siteOrigins.origins[origin]
+		}
+		origins := make(map[string]bool)
+		for _, site := range sites {
+			for _, o := range site.Origins() {
+				origins[strings.TrimSuffix(strings.ToLower(o), "/")] = true
+			}
+		}
+		siteOrigins.origins = origins
+		siteOrigins.expiresAt = time.Now().Add(siteOriginsTTL)
+	}
+	return siteOrigins.origins[origin]
+}
+
+// 網站設定變更後清除 CORS 來源快取
+func InvalidateSiteOrigins() {
+	siteOrigins.mu.Lock()
+	siteOrigins.expiresAt = time.Time{}
+	siteOrigins.mu.Unlock()
+}
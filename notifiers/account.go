@@ -0,0 +1,129 @@
+package notifiers
+
+import (
+	"errors"
+	"fmt"
+	"messageboard/config"
+	"messageboard/models"
+	"os"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Email 驗證連結的有效期間
+func verifyEmailTTL() time.Duration {
+	return config.GetEnvAsDuration("EMAIL_VERIFY_TTL", 24*time.Hour)
+}
+
+// 重設密碼連結的有效期間
+func passwordResetTTL() time.Duration {
+	return config.GetEnvAsDuration("PASSWORD_RESET_TTL", time.Hour)
+}
+
+// 是否為帳號通知（驗證 Email 等），帳號通知不受通知偏好影響，也不附取消訂閱連結
+func isAccountEvent(event string) bool {
+	return strings.HasPrefix(event, "account.")
+}
+
+// 寄送帳號通知給使用者，需與帳號變更在同一個交易中呼叫
+// 只寄送到個人通知管道；已有尚未寄出的同類通知時不重複排程
+func EnqueueAccountEmail(tx *gorm.DB, event string, user models.User) error {
+	if user.Email == "" {
+		return nil
+	}
+
+	var pending int64
+	if err := tx.Model(&models.OutboxMessage{}).
+		Where("event = ? AND recipient_user_id = ? AND status = ?", event, user.ID, models.OutboxPending).
+		Count(&pending).Error; err != nil {
+		return err
+	}
+	if pending > 0 {
+		return nil
+	}
+
+	var messages []models.OutboxMessage
+	for _, notifier := range configured() {
+		if !notifier.Personal() {
+			continue
+		}
+		messages = append(messages, models.OutboxMessage{
+			Channel:         notifier.Name(),
+			Event:           event,
+			RecipientUserID: &user.ID,
+			RecipientEmail:  user.Email,
+			Status:          models.OutboxPending,
+			NextAttemptAt:   time.Now(),
+		})
+	}
+	if len(messages) == 0 {
+		return nil
+	}
+	return tx.Create(&messages).Error
+}
+
+// 寄送前準備帳號通知的內容：確認帳號狀態仍需通知，並產生連結
+// 連結在寄送時才簽署，資料庫中不保存任何 Token
+func prepareAccountEmail(db *gorm.DB, msg models.OutboxMessage, n *Notification) error {
+	if msg.RecipientUserID == nil {
+		return fmt.Errorf("%w: 帳號通知缺少收件者", errPermanent)
+	}
+	var user models.User
+	if err := db.First(&user, *msg.RecipientUserID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return errSkipped
+		}
+		return err
+	}
+	// 排程後已變更 Email 的使用者不再寄送到舊信箱
+	if user.Email != msg.RecipientEmail {
+		return errSkipped
+	}
+	n.Username = user.Username
+
+	switch msg.Event {
+	case models.EventAccountVerifyEmail:
+		if user.EmailVerified {
+			return errSkipped
+		}
+		n.ActionTTL = verifyEmailTTL()
+		token, err := models.SignPurposeToken(user.ID, models.PurposeVerifyEmail, user.Email, n.ActionTTL)
+		if err != nil {
+			return err
+		}
+		n.ActionURL, err = actionURL("EMAIL_VERIFY_URL", "/api/v1/verify-email", token)
+		return err
+	case models.EventAccountPasswordReset:
+		n.ActionTTL = passwordResetTTL()
+		token, err := models.SignPurposeToken(user.ID, models.PurposeResetPassword, models.PasswordFingerprint(user), n.ActionTTL)
+		if err != nil {
+			return err
+		}
+		// 重設密碼需由前端頁面輸入新密碼，沒有 API 連結可用
+		n.ActionURL, err = actionURL("PASSWORD_RESET_URL", "", token)
+		return err
+	default:
+		return fmt.Errorf("%w: 未知的帳號通知 %s", errPermanent, msg.Event)
+	}
+}
+
+// 產生帶有 Token 的連結：優先使用前端頁面（envKey），否則指向 API（apiPath 為空表示必須設定前端頁面）
+func actionURL(envKey, apiPath, token string) (string, error) {
+	if page := os.Getenv(envKey); page != "" {
+		separator := "?"
+		if strings.Contains(page, "?") {
+			separator = "&"
+		}
+		return page + separator + "token=" + token, nil
+	}
+	if apiPath == "" {
+		return "", fmt.Errorf("%w: 未設定 %s", errPermanent, envKey)
+	}
+	baseURL := strings.TrimRight(os.Getenv("APP_BASE_URL"), "/")
+	if baseURL == "" {
+		return "", fmt.Errorf("%w: 未設定 APP_BASE_URL 或 %s", errPermanent, envKey)
+	}
+	return baseURL + apiPath + "?token=" + token, nil
+}
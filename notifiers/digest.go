@@ -0,0 +1,117 @@
+package notifiers
+
+import (
+	"log"
+	"messageboard/config"
+	"messageboard/models"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// 網站摘要中新留言最多的頁面
+type DigestPage struct {
+	URL   string
+	Count int64
+}
+
+// 摘要最多列出的頁面數
+const digestPageLimit = 20
+
+// 網站摘要的期間（DIGEST_INTERVAL），每位使用者每個期間最多寄送一封
+func digestInterval() time.Duration {
+	return config.GetEnvAsDuration("DIGEST_INTERVAL", 24*time.Hour)
+}
+
+// 為開啟網站摘要且已到期的使用者排程摘要通知
+func (w *Worker) scheduleDigests() {
+	if !Enabled() {
+		return
+	}
+	now := time.Now()
+	due := now.Add(-digestInterval())
+
+	for {
+		var prefs []models.NotificationPreference
+		if err := w.db.Joins("JOIN users ON users.id = notification_preferences.user_id").
+			Where("notification_preferences.notify_digest AND users.email <> ''").
+			Where("notification_preferences.last_digest_at IS NULL OR notification_preferences.last_digest_at <= ?", due).
+			Limit(w.batchSize).
+			Find(&prefs).Error; err != nil {
+			log.Printf("查詢網站摘要收件者失敗: %v\n", err)
+			return
+		}
+		for _, pref := range prefs {
+			if err := w.db.Transaction(func(tx *gorm.DB) error {
+				return enqueueDigest(tx, pref, now, due)
+			}); err != nil {
+				log.Printf("排程網站摘要失敗: %v\n", err)
+				return
+			}
+		}
+		if len(prefs) < w.batchSize {
+			return
+		}
+	}
+}
+
+// 以條件更新 last_digest_at 取得排程權，多個副本同時執行時只有一個會寫入 outbox
+// 摘要期間由上次摘要開始，寫入 outbox 的 CreatedAt 作為期間的起點
+func enqueueDigest(tx *gorm.DB, pref models.NotificationPreference, now, due time.Time) error {
+	result := tx.Model(&models.NotificationPreference{}).
+		Where("id = ? AND (last_digest_at IS NULL OR last_digest_at <= ?)", pref.ID, due).
+		Update("last_digest_at", now)
+	if result.Error != nil || result.RowsAffected == 0 {
+		return result.Error
+	}
+
+	var user models.User
+	if err := tx.First(&user, pref.UserID).Error; err != nil {
+		return err
+	}
+	since := due
+	if pref.LastDigestAt != nil {
+		since = *pref.LastDigestAt
+	}
+
+	var messages []models.OutboxMessage
+	for _, notifier := range configured() {
+		if !notifier.Personal() {
+			continue
+		}
+		messages = append(messages, models.OutboxMessage{
+			Channel:         notifier.Name(),
+			Event:           models.EventSiteDigest,
+			RecipientUserID: &user.ID,
+			RecipientEmail:  user.Email,
+			Status:          models.OutboxPending,
+			NextAttemptAt:   now,
+			CreatedAt:       since,
+		})
+	}
+	if len(messages) == 0 {
+		return nil
+	}
+	return tx.Create(&messages).Error
+}
+
+// 統計摘要期間內公開的新留言，沒有新留言時不寄送
+func prepareDigest(db *gorm.DB, msg models.OutboxMessage, n *Notification) error {
+	query := db.Model(&models.Comment{}).Where("status = ? AND created_at >= ?", models.CommentVisible, msg.CreatedAt)
+	if err := query.Session(&gorm.Session{}).Count(&n.CommentCount).Error; err != nil {
+		return err
+	}
+	if n.CommentCount == 0 {
+		return errSkipped
+	}
+	if err := query.Session(&gorm.Session{}).
+		Select("url, COUNT(*) AS count").
+		Group("url").
+		Order("count DESC, url ASC").
+		Limit(digestPageLimit).
+		Scan(&n.DigestPages).Error; err != nil {
+		return err
+	}
+	n.Window = digestInterval()
+	return nil
+}
@@ -0,0 +1,70 @@
+package notifiers
+
+import (
+	"context"
+	"fmt"
+	"messageboard/config"
+	"os"
+	"time"
+
+	mail "github.com/xhit/go-simple-mail/v2"
+)
+
+// 透過 SMTP 寄送 Email 通知
+type SMTPNotifier struct {
+	host     string
+	port     int
+	username string
+	password string
+	from     string
+}
+
+func NewSMTPNotifier() *SMTPNotifier {
+	return &SMTPNotifier{
+		host:     os.Getenv("MAIL_HOST"),
+		port:     config.GetEnvAsInt("MAIL_PORT", 587),
+		username: os.Getenv("MAIL_USERNAME"),
+		password: os.Getenv("MAIL_PASSWORD"),
+		from:     os.Getenv("MAIL_FROM"),
+	}
+}
+
+func (s *SMTPNotifier) Name() string   { return ChannelSMTP }
+func (s *SMTPNotifier) Personal() bool { return true }
+
+func (s *SMTPNotifier) Notify(ctx context.Context, n Notification) error {
+	rendered, err := renderEmail(n)
+	if err != nil {
+		return fmt.Errorf("%w: %v", errPermanent, err)
+	}
+
+	server := mail.NewSMTPClient()
+	server.Host = s.host
+	server.Port = s.port
+	server.Username = s.username
+	server.Password = s.password
+	server.Encryption = mail.EncryptionSTARTTLS
+	server.ConnectTimeout = 10 * time.Second
+	server.SendTimeout = 10 * time.Second
+
+	smtpClient, err := server.Connect()
+	if err != nil {
+		return err
+	}
+
+	email := mail.NewMSG()
+	email.SetFrom(s.from).
+		AddTo(n.RecipientEmail).
+		SetSubject(rendered.Subject)
+
+	if n.OneClickURL != "" {
+		email.SetListUnsubscribe("<" + n.OneClickURL + ">")
+		email.AddHeader("List-Unsubscribe-Post", "List-Unsubscribe=One-Click")
+	}
+
+	// 純文字為主要內容，HTML 為替代內容
+	email.SetBody(mail.TextPlain, rendered.Text)
+	email.AddAlternative(mail.TextHTML, rendered.HTML)
+
+	return email.Send(smtpClient)
+}
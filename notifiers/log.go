@@ -0,0 +1,26 @@
+package notifiers
+
+import (
+	"context"
+	"fmt"
+	"log"
+)
+
+// 將通知輸出到標準輸出，供開發環境測試使用
+type LogNotifier struct{}
+
+func NewLogNotifier() *LogNotifier {
+	return &LogNotifier{}
+}
+
+func (l *LogNotifier) Name() string   { return ChannelLog }
+func (l *LogNotifier) Personal() bool { return true }
+
+func (l *LogNotifier) Notify(ctx context.Context, n Notification) error {
+	rendered, err := renderEmail(n)
+	if err != nil {
+		return fmt.Errorf("%w: %v", errPermanent, err)
+	}
+	log.Printf("[通知] #%d %s → %s\n主旨：%s\n%s\n", n.DeliveryID, n.Event, n.RecipientEmail, rendered.Subject, rendered.Text)
+	return nil
+}
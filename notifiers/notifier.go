@@ -0,0 +1,92 @@
+package notifiers
+
+import (
+	"context"
+	"log"
+	"messageboard/models"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 通知管道名稱，對應 outbox 的 channel 欄位
+const (
+	ChannelSMTP    = "smtp"
+	ChannelWebhook = "webhook"
+	ChannelLog     = "log"
+)
+
+// 交給通知管道的通知內容
+type Notification struct {
+	DeliveryID      uint           // outbox ID，可供接收端去重
+	Event           string         // 通知事件
+	RecipientEmail  string         // 個人通知的收件者信箱
+	RecipientUserID *uint          // 收件者為使用者時的 ID
+	Comment         models.Comment // 相關留言（含作者）
+	UnsubscribeURL  string         // 信件內文的取消訂閱連結（前端頁面或 API 的確認頁）
+	OneClickURL     string         // List-Unsubscribe 標頭的一鍵取消訂閱連結（RFC 8058，以 POST 送出）
+	Locale          string         // 收件者語系
+	LikeCount       int64          // 點讚通知：期間內的點讚人數
+	Window          time.Duration  // 點讚通知、網站摘要：彙整的期間
+	CommentCount    int64          // 網站摘要：期間內的新留言數
+	DigestPages     []DigestPage   // 網站摘要：新留言最多的頁面
+	Username        string         // 帳號通知：收件者的使用者名稱
+	ActionURL       string         // 帳號通知：驗證或操作連結
+	ActionTTL       time.Duration  // 帳號通知：連結的有效期間
+}
+
+// 通知管道
+type Notifier interface {
+	// 管道名稱
+	Name() string
+	// 是否寄送給個別收件者（如 Email）；否則為網站層級的事件通知（如 Webhook）
+	Personal() bool
+	// 寄送通知，回傳錯誤時由 worker 重試
+	Notify(ctx context.Context, n Notification) error
+}
+
+var (
+	setupOnce sync.Once
+	channels  []Notifier
+)
+
+// 依環境變數 NOTIFIERS 建立通知管道（逗號分隔：smtp, webhook, log）
+// 未設定時，若有 MAIL_HOST 則使用 smtp
+func configured() []Notifier {
+	setupOnce.Do(func() {
+		names := os.Getenv("NOTIFIERS")
+		if names == "" && os.Getenv("MAIL_HOST") != "" {
+			names = ChannelSMTP
+		}
+		for _, name := range strings.Split(names, ",") {
+			switch strings.TrimSpace(name) {
+			case "":
+			case ChannelSMTP:
+				channels = append(channels, NewSMTPNotifier())
+			case ChannelWebhook:
+				notifier, err := NewWebhookNotifier()
+				if err != nil {
+					log.Printf("無法啟用 webhook 通知: %v\n", err)
+					continue
+				}
+				channels = append(channels, notifier)
+			case ChannelLog:
+				channels = append(channels, NewLogNotifier())
+			default:
+				log.Printf("未知的通知管道：%s\n", name)
+			}
+		}
+	})
+	return channels
+}
+
+// 依名稱取得已啟用的通知管道
+func notifierByName(name string) Notifier {
+	for _, notifier := range configured() {
+		if notifier.Name() == name {
+			return notifier
+		}
+	}
+	return nil
+}
@@ -0,0 +1,219 @@
+package notifiers
+
+import (
+	"fmt"
+	"messageboard/config"
+	"messageboard/models"
+	"os"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+/*
+* Notifiers
+*
+* 留言通知：寫入 outbox 佇列，由背景 Worker 透過各通知管道（Notifier）非同步寄送
+ */
+
+// 通知 Worker 有新的訊息待寄送
+var wakeCh = make(chan struct{}, 1)
+
+// 是否有啟用的通知管道
+func Enabled() bool {
+	return len(configured()) > 0
+}
+
+// 依留言決定收件者並寫入 outbox，需與建立留言在同一個交易中呼叫
+// 每個通知管道各寫入一筆，重試時不會重複寄送到其他管道
+func EnqueueCommentNotifications(tx *gorm.DB, comment models.Comment) error {
+	if !Enabled() {
+		return nil
+	}
+
+	personal, err := personalRecipient(tx, comment)
+	if err != nil {
+		return err
+	}
+
+	// 網站層級的事件：每則新留言都送出，不論是否有個人收件者
+	siteEvent := models.EventCommentCreated
+	if comment.Status == models.CommentPending {
+		siteEvent = models.EventCommentPending
+	}
+
+	var messages []models.OutboxMessage
+	for _, notifier := range configured() {
+		var msg models.OutboxMessage
+		if notifier.Personal() {
+			if personal == nil {
+				continue
+			}
+			msg = *personal
+		} else {
+			msg = models.OutboxMessage{Event: siteEvent}
+		}
+		msg.Channel = notifier.Name()
+		msg.CommentID = &comment.ID
+		msg.Status = models.OutboxPending
+		msg.NextAttemptAt = time.Now()
+		messages = append(messages, msg)
+	}
+	if len(messages) == 0 {
+		return nil
+	}
+	return tx.Create(&messages).Error
+}
+
+// 決定個人通知（Email）的收件者，不需通知時回傳 nil
+func personalRecipient(tx *gorm.DB, comment models.Comment) (*models.OutboxMessage, error) {
+	msg := &models.OutboxMessage{}
+
+	ownerEmail, err := siteNotifyEmail(tx, comment)
+	if err != nil {
+		return nil, err
+	}
+
+	// 待審核的留言只通知站長審核，不通知被回覆者
+	if comment.Status == models.CommentPending {
+		msg.RecipientEmail = ownerEmail
+		if msg.RecipientEmail == "" {
+			return nil, nil
+		}
+		msg.Event = models.EventCommentPending
+	} else if comment.ParentID != nil {
+		// 如果是回覆留言，通知父留言的作者
+		var parentComment models.Comment
+		if err := tx.Preload("User").First(&parentComment, *comment.ParentID).Error; err == nil && parentComment.User.Email != "" {
+			// 回覆自己的留言不需通知
+			if comment.UserID != nil && parentComment.IsOwnedBy(*comment.UserID) {
+				return nil, nil
+			}
+			msg.RecipientEmail = parentComment.User.Email
+			msg.RecipientUserID = parentComment.UserID
+			msg.Event = models.EventCommentReply
+		} else {
+			// 找不到父留言或父留言作者沒信箱，通知自己（訪客不寄送）
+			if comment.IsGuest() {
+				return nil, nil
+			}
+			msg.RecipientEmail = comment.User.Email
+			msg.RecipientUserID = comment.UserID
+			msg.Event = models.EventCommentCreated
+		}
+	} else {
+		// 主留言通知站長
+		msg.RecipientEmail = ownerEmail
+		if msg.RecipientEmail == "" {
+			// 未設定站長信箱時通知自己（訪客不寄送）
+			if comment.IsGuest() {
+				return nil, nil
+			}
+			msg.RecipientEmail = comment.User.Email
+			msg.RecipientUserID = comment.UserID
+		}
+		msg.Event = models.EventCommentCreated
+	}
+
+	return msg, nil
+}
+
+// 站長的通知信箱：依留言所屬網站的設定，未設定時使用 MAIL_TO
+func siteNotifyEmail(tx *gorm.DB, comment models.Comment) (string, error) {
+	if comment.SiteID != nil {
+		var site models.Site
+		if err := tx.First(&site, *comment.SiteID).Error; err != nil {
+			return "", err
+		}
+		if site.NotifyEmail != "" {
+			return site.NotifyEmail, nil
+		}
+	}
+	return os.Getenv("MAIL_TO"), nil
+}
+
+// 點讚通知的彙整期間，期間內的點讚合併為一封通知
+func likeWindow() time.Duration {
+	return config.GetEnvAsDuration("LIKE_NOTIFY_WINDOW", time.Hour)
+}
+
+// 留言被點讚時排程點讚通知，需與建立點讚在同一個交易中呼叫
+// 每則留言在每個管道同時只有一筆待寄送的點讚通知（dedupe key 的唯一索引），寄送時再統計期間內仍存在的點讚
+func EnqueueLikeNotification(tx *gorm.DB, comment models.Comment, like models.CommentLike) error {
+	// 訪客留言與自己點讚不需通知
+	if !Enabled() || comment.IsGuest() || comment.IsOwnedBy(like.UserID) {
+		return nil
+	}
+
+	var author models.User
+	if err := tx.First(&author, *comment.UserID).Error; err != nil || author.Email == "" {
+		return nil
+	}
+
+	var messages []models.OutboxMessage
+	for _, notifier := range configured() {
+		if !notifier.Personal() {
+			continue
+		}
+		dedupeKey := fmt.Sprintf("%s:%d:%s", models.EventCommentLiked, comment.ID, notifier.Name())
+		messages = append(messages, models.OutboxMessage{
+			Channel:         notifier.Name(),
+			Event:           models.EventCommentLiked,
+			DedupeKey:       &dedupeKey,
+			CommentID:       &comment.ID,
+			RecipientUserID: &author.ID,
+			RecipientEmail:  author.Email,
+			Status:          models.OutboxPending,
+			NextAttemptAt:   like.CreatedAt.Add(likeWindow()),
+			CreatedAt:       like.CreatedAt, // 彙整期間的起點
+		})
+	}
+	if len(messages) == 0 {
+		return nil
+	}
+	// 已有待寄送的點讚通知時略過，同時發生的點讚也不會重複排程
+	return tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&messages).Error
+}
+
+// 喚醒 Worker 立即處理佇列，於交易提交後呼叫
+func Wake() {
+	select {
+	case wakeCh <- struct{}{}:
+	default:
+	}
+}
+
+// 通知事件對應的偏好設定範圍
+func preferenceScope(event string) string {
+	switch event {
+	case models.EventCommentCreated, models.EventCommentReply:
+		return models.NotifyScopeReplies
+	case models.EventCommentLiked:
+		return models.NotifyScopeLikes
+	case models.EventSiteDigest:
+		return models.NotifyScopeDigest
+	default:
+		return ""
+	}
+}
+
+// 產生取消訂閱連結：page 放在信件內文，優先使用前端頁面（UNSUBSCRIBE_URL），否則為 API 的確認頁
+// oneClick 放在 List-Unsubscribe 標頭，一律指向 API；未設定對應的網址時回傳空字串
+func unsubscribeLinks(userID uint, scope string) (page, oneClick string, err error) {
+	token, err := models.SignPurposeToken(userID, models.PurposeUnsubscribe, scope, 0)
+	if err != nil {
+		return "", "", err
+	}
+	if baseURL := strings.TrimRight(os.Getenv("APP_BASE_URL"), "/"); baseURL != "" {
+		oneClick = baseURL + "/api/v1/unsubscribe?token=" + token
+	}
+	page = oneClick
+	if os.Getenv("UNSUBSCRIBE_URL") != "" {
+		if page, err = actionURL("UNSUBSCRIBE_URL", "", token); err != nil {
+			return "", "", err
+		}
+	}
+	return page, oneClick, nil
+}
@@ -0,0 +1,180 @@
+package notifiers
+
+import (
+	"bytes"
+	"embed"
+	"errors"
+	"fmt"
+	htmltemplate "html/template"
+	"io/fs"
+	"messageboard/models"
+	"os"
+	"strings"
+	"sync"
+	texttemplate "text/template"
+	"time"
+)
+
+// 內建的通知信範本，可透過 MAIL_TEMPLATE_DIR 指定目錄覆寫
+// 目錄結構：{locale}/{事件}.html.tmpl 與 {locale}/{事件}.txt.tmpl
+// 純文字範本需定義 "subject" 區塊作為信件主旨
+//
+//go:embed templates
+var embeddedTemplates embed.FS
+
+// 範本可使用的資料
+type emailData struct {
+	Event          string
+	Author         string
+	Content        string
+	URL            string
+	CreatedAt      string
+	UnsubscribeURL string
+	LikeCount      int64        // 點讚通知：期間內的點讚人數
+	Window         string       // 點讚通知、網站摘要：彙整的期間
+	CommentCount   int64        // 網站摘要：期間內的新留言數
+	Pages          []DigestPage // 網站摘要：新留言最多的頁面
+	Username       string       // 帳號通知：收件者的使用者名稱
+	ActionURL      string       // 帳號通知：驗證或操作連結
+	ActionTTL      string       // 帳號通知：連結的有效期間
+}
+
+// 渲染完成的信件
+type renderedEmail struct {
+	Subject string
+	HTML    string
+	Text    string
+}
+
+type emailTemplate struct {
+	html *htmltemplate.Template
+	text *texttemplate.Template
+}
+
+var templateCache sync.Map // key: locale/name → *emailTemplate
+
+// 預設語系，用於站長信箱或未設定語系的使用者
+func defaultLocale() string {
+	return normalizeLocale(os.Getenv("MAIL_LOCALE"))
+}
+
+// 將語系字串正規化為支援的語系，無法辨識時使用 zh-TW
+func normalizeLocale(locale string) string {
+	switch strings.ToLower(strings.ReplaceAll(locale, "_", "-")) {
+	case "en", "en-us", "en-gb":
+		return models.LocaleEn
+	default:
+		return models.LocaleZhTW
+	}
+}
+
+// 依事件與語系渲染通知信
+func renderEmail(n Notification) (renderedEmail, error) {
+	var rendered renderedEmail
+
+	locale := n.Locale
+	if locale == "" {
+		locale = defaultLocale()
+	}
+	tmpl, err := loadTemplate(locale, templateName(n.Event))
+	if err != nil {
+		return rendered, err
+	}
+
+	data := emailData{
+		Event:          n.Event,
+		Author:         n.Comment.AuthorName(),
+		Content:        n.Comment.Content,
+		URL:            n.Comment.URL,
+		CreatedAt:      n.Comment.CreatedAt.Format("2006-01-02 15:04:05"),
+		UnsubscribeURL: n.UnsubscribeURL,
+		LikeCount:      n.LikeCount,
+		Window:         formatWindow(n.Window, locale),
+		CommentCount:   n.CommentCount,
+		Pages:          n.DigestPages,
+		Username:       n.Username,
+		ActionURL:      n.ActionURL,
+		ActionTTL:      formatWindow(n.ActionTTL, locale),
+	}
+
+	var subject, html, text bytes.Buffer
+	if err := tmpl.text.ExecuteTemplate(&subject, "subject", data); err != nil {
+		return rendered, err
+	}
+	if err := tmpl.text.Execute(&text, data); err != nil {
+		return rendered, err
+	}
+	if err := tmpl.html.Execute(&html, data); err != nil {
+		return rendered, err
+	}
+
+	rendered.Subject = strings.TrimSpace(subject.String())
+	rendered.Text = text.String()
+	rendered.HTML = html.String()
+	return rendered, nil
+}
+
+// 將彙整期間轉為易讀的文字，例如 1 小時、30 minutes
+func formatWindow(d time.Duration, locale string) string {
+	value, unit := int64(d/time.Minute), "minute"
+	if d >= time.Hour && d%time.Hour == 0 {
+		value, unit = int64(d/time.Hour), "hour"
+	}
+
+	if locale == models.LocaleEn {
+		if value != 1 {
+			unit += "s"
+		}
+		return fmt.Sprintf("%d %s", value, unit)
+	}
+	if unit == "hour" {
+		return fmt.Sprintf("%d 小時", value)
+	}
+	return fmt.Sprintf("%d 分鐘", value)
+}
+
+// 通知事件對應的範本名稱，例如 comment.reply → comment_reply
+func templateName(event string) string {
+	return strings.ReplaceAll(event, ".", "_")
+}
+
+// 載入範本，優先使用 MAIL_TEMPLATE_DIR 中的檔案
+func loadTemplate(locale, name string) (*emailTemplate, error) {
+	key := locale + "/" + name
+	if cached, ok := templateCache.Load(key); ok {
+		return cached.(*emailTemplate), nil
+	}
+
+	htmlSource, err := readTemplate(locale, name+".html.tmpl")
+	if err != nil {
+		return nil, err
+	}
+	textSource, err := readTemplate(locale, name+".txt.tmpl")
+	if err != nil {
+		return nil, err
+	}
+
+	tmpl := &emailTemplate{}
+	if tmpl.html, err = htmltemplate.New(name).Parse(string(htmlSource)); err != nil {
+		return nil, err
+	}
+	if tmpl.text, err = texttemplate.New(name).Parse(string(textSource)); err != nil {
+		return nil, err
+	}
+
+	templateCache.Store(key, tmpl)
+	return tmpl, nil
+}
+
+func readTemplate(locale, file string) ([]byte, error) {
+	if dir := os.Getenv("MAIL_TEMPLATE_DIR"); dir != "" {
+		data, err := fs.ReadFile(os.DirFS(dir), locale+"/"+file)
+		if err == nil {
+			return data, nil
+		}
+		if !errors.Is(err, fs.ErrNotExist) {
+			return nil, err
+		}
+	}
+	return embeddedTemplates.ReadFile("templates/" + locale + "/" + file)
+}
@@ -0,0 +1,131 @@
+package notifiers
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"messageboard/config"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+)
+
+// 以 HTTP POST 將留言事件送到 Webhook（如 Slack、Discord 或自架服務）
+// 設定 WEBHOOK_SECRET 時，以 HMAC-SHA256 簽署 "{timestamp}.{body}"，
+// 簽章放在 X-Messageboard-Signature 標頭，格式為 sha256=<hex>
+type WebhookNotifier struct {
+	url    string
+	secret []byte
+	client *http.Client
+}
+
+// Webhook 的 JSON 內容
+type webhookPayload struct {
+	Event      string         `json:"event"`
+	DeliveryID uint           `json:"delivery_id"`
+	Timestamp  int64          `json:"timestamp"`
+	Text       string         `json:"text"`    // Slack 相容的訊息文字
+	Content    string         `json:"content"` // Discord 相容的訊息文字
+	Comment    webhookComment `json:"comment"`
+}
+
+type webhookComment struct {
+	ID        uint      `json:"id"`
+	URL       string    `json:"url"`
+	ParentID  *uint     `json:"parent_id"`
+	Status    string    `json:"status"`
+	Content   string    `json:"content"`
+	Author    string    `json:"author"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func NewWebhookNotifier() (*WebhookNotifier, error) {
+	url := os.Getenv("WEBHOOK_URL")
+	if url == "" {
+		return nil, errors.New("未設定 WEBHOOK_URL")
+	}
+	return &WebhookNotifier{
+		url:    url,
+		secret: []byte(os.Getenv("WEBHOOK_SECRET")),
+		client: &http.Client{Timeout: config.GetEnvAsDuration("WEBHOOK_TIMEOUT", 10*time.Second)},
+	}, nil
+}
+
+func (w *WebhookNotifier) Name() string   { return ChannelWebhook }
+func (w *WebhookNotifier) Personal() bool { return false }
+
+func (w *WebhookNotifier) Notify(ctx context.Context, n Notification) error {
+	comment := n.Comment
+	rendered, err := renderEmail(n)
+	if err != nil {
+		return fmt.Errorf("%w: %v", errPermanent, err)
+	}
+	text := fmt.Sprintf("%s\n%s：%s\n%s", rendered.Subject, comment.AuthorName(), comment.Content, comment.URL)
+	now := time.Now()
+
+	body, err := json.Marshal(webhookPayload{
+		Event:      n.Event,
+		DeliveryID: n.DeliveryID,
+		Timestamp:  now.Unix(),
+		Text:       text,
+		Content:    text,
+		Comment: webhookComment{
+			ID:        comment.ID,
+			URL:       comment.URL,
+			ParentID:  comment.ParentID,
+			Status:    comment.Status,
+			Content:   comment.Content,
+			Author:    comment.AuthorName(),
+			CreatedAt: comment.CreatedAt,
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("%w: %v", errPermanent, err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("%w: %v", errPermanent, err)
+	}
+	timestamp := strconv.FormatInt(now.Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "messageboard-webhook")
+	req.Header.Set("X-Messageboard-Event", n.Event)
+	req.Header.Set("X-Messageboard-Delivery", strconv.FormatUint(uint64(n.DeliveryID), 10))
+	req.Header.Set("X-Messageboard-Timestamp", timestamp)
+	if len(w.secret) > 0 {
+		req.Header.Set("X-Messageboard-Signature", "sha256="+w.sign(timestamp, body))
+	}
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return nil
+	case resp.StatusCode == http.StatusRequestTimeout || resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500:
+		return fmt.Errorf("webhook 回應 %d", resp.StatusCode)
+	default:
+		// 其他 4xx 代表請求本身有誤，重試也不會成功
+		return fmt.Errorf("%w: webhook 回應 %d", errPermanent, resp.StatusCode)
+	}
+}
+
+func (w *WebhookNotifier) sign(timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, w.secret)
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
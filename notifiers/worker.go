@@ -0,0 +1,244 @@
+package notifiers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand/v2"
+	"messageboard/config"
+	"messageboard/models"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	// 無法透過重試解決的錯誤，直接移入 dead letter
+	errPermanent = errors.New("無法寄送的通知")
+	// 收件者已取消訂閱或已無需通知的內容，不需寄送
+	errSkipped = errors.New("不需寄送的通知")
+)
+
+// 背景寄送 outbox 中的通知，失敗時以指數退避重試
+type Worker struct {
+	db           *gorm.DB
+	pollInterval time.Duration // 輪詢間隔
+	batchSize    int           // 每次處理的筆數
+	maxAttempts  int           // 超過此次數移入 dead letter
+	retryBase    time.Duration // 第一次重試的等待時間，之後每次加倍
+	retryMax     time.Duration // 重試等待時間上限
+	lease        time.Duration // 取出後的鎖定時間，避免其他副本重複寄送
+	drainTimeout time.Duration // 關閉時清空佇列的時間上限
+	digestCheck  time.Duration // 檢查網站摘要是否到期的間隔
+}
+
+func NewWorker(db *gorm.DB) *Worker {
+	return &Worker{
+		db:           db,
+		pollInterval: config.GetEnvAsDuration("NOTIFY_POLL_INTERVAL", 5*time.Second),
+		batchSize:    config.GetEnvAsInt("NOTIFY_BATCH_SIZE", 20),
+		maxAttempts:  config.GetEnvAsInt("NOTIFY_MAX_ATTEMPTS", 8),
+		retryBase:    config.GetEnvAsDuration("NOTIFY_RETRY_BASE", 30*time.Second),
+		retryMax:     config.GetEnvAsDuration("NOTIFY_RETRY_MAX", time.Hour),
+		lease:        2 * time.Minute,
+		drainTimeout: config.GetEnvAsDuration("NOTIFY_DRAIN_TIMEOUT", 10*time.Second),
+		digestCheck:  10 * time.Minute,
+	}
+}
+
+// 持續處理佇列直到 ctx 結束，結束前會在 drainTimeout 內盡量寄出已到期的通知
+func (w *Worker) Run(ctx context.Context) {
+	ticker := time.NewTicker(w.pollInterval)
+	defer ticker.Stop()
+	digestTicker := time.NewTicker(w.digestCheck)
+	defer digestTicker.Stop()
+
+	w.scheduleDigests()
+	for {
+		w.processDue(ctx)
+
+		select {
+		case <-ctx.Done():
+			w.drain()
+			return
+		case <-ticker.C:
+		case <-wakeCh:
+		case <-digestTicker.C:
+			w.scheduleDigests()
+		}
+	}
+}
+
+// 關閉前清空佇列，未寄出的通知會保留在資料庫中，下次啟動時繼續寄送
+func (w *Worker) drain() {
+	ctx, cancel := context.WithTimeout(context.Background(), w.drainTimeout)
+	defer cancel()
+
+	w.processDue(ctx)
+	log.Println("通知佇列已停止")
+}
+
+// 處理所有已到期的通知，直到佇列清空或 ctx 結束
+func (w *Worker) processDue(ctx context.Context) {
+	for ctx.Err() == nil {
+		n, err := w.processBatch(ctx)
+		if err != nil {
+			log.Printf("處理通知佇列失敗: %v\n", err)
+			return
+		}
+		if n < w.batchSize {
+			return
+		}
+	}
+}
+
+// 取出一批到期的通知並寄送，回傳處理的筆數
+func (w *Worker) processBatch(ctx context.Context) (int, error) {
+	var batch []models.OutboxMessage
+	now := time.Now()
+
+	// 以 SKIP LOCKED 取出並延後下次嘗試時間，多個副本同時執行時不會重複寄送
+	err := w.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("status = ? AND next_attempt_at <= ?", models.OutboxPending, now).
+			Order("next_attempt_at ASC").
+			Limit(w.batchSize).
+			Find(&batch).Error; err != nil {
+			return err
+		}
+		if len(batch) == 0 {
+			return nil
+		}
+
+		ids := make([]uint, len(batch))
+		for i, msg := range batch {
+			ids[i] = msg.ID
+		}
+		return tx.Model(&models.OutboxMessage{}).Where("id IN ?", ids).
+			Update("next_attempt_at", now.Add(w.lease)).Error
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	for _, msg := range batch {
+		w.finish(msg, w.deliver(ctx, msg))
+	}
+	return len(batch), nil
+}
+
+// 寄送單一通知，收件者已取消訂閱或無需通知時回傳 errSkipped
+func (w *Worker) deliver(ctx context.Context, msg models.OutboxMessage) error {
+	notifier := notifierByName(msg.Channel)
+	if notifier == nil {
+		return fmt.Errorf("%w: 通知管道 %s 未啟用", errPermanent, msg.Channel)
+	}
+
+	n := Notification{
+		DeliveryID:      msg.ID,
+		Event:           msg.Event,
+		RecipientEmail:  msg.RecipientEmail,
+		RecipientUserID: msg.RecipientUserID,
+		Locale:          defaultLocale(),
+	}
+	if msg.CommentID != nil {
+		if err := w.db.Unscoped().Preload("User").First(&n.Comment, *msg.CommentID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return fmt.Errorf("%w: 留言不存在", errPermanent)
+			}
+			return err
+		}
+	}
+
+	// 點讚通知：統計彙整期間內仍存在的點讚，反覆按讚又取消的使用者不會重複計算
+	if msg.Event == models.EventCommentLiked {
+		if err := w.db.Model(&models.CommentLike{}).
+			Where("comment_id = ? AND created_at >= ?", n.Comment.ID, msg.CreatedAt).
+			Count(&n.LikeCount).Error; err != nil {
+			return err
+		}
+		if n.LikeCount == 0 {
+			return errSkipped
+		}
+		n.Window = likeWindow()
+	}
+
+	// 網站摘要：統計期間內的新留言
+	if msg.Event == models.EventSiteDigest {
+		if err := prepareDigest(w.db, msg, &n); err != nil {
+			return err
+		}
+	}
+
+	// 帳號通知：確認帳號狀態並產生連結
+	account := isAccountEvent(msg.Event)
+	if account {
+		if err := prepareAccountEmail(w.db, msg, &n); err != nil {
+			return err
+		}
+	}
+
+	// 收件者為使用者時，依其通知偏好決定是否寄送與語系，並附上取消訂閱連結
+	// 帳號通知一律寄送，只套用語系
+	if msg.RecipientUserID != nil {
+		scope := preferenceScope(msg.Event)
+		pref, err := models.GetNotificationPreference(*msg.RecipientUserID)
+		if err != nil {
+			return err
+		}
+		if !account && !pref.Allows(scope) {
+			return errSkipped
+		}
+		if pref.Locale != "" {
+			n.Locale = normalizeLocale(pref.Locale)
+		}
+		if !account {
+			if n.UnsubscribeURL, n.OneClickURL, err = unsubscribeLinks(*msg.RecipientUserID, scope); err != nil {
+				return err
+			}
+		}
+	}
+
+	return notifier.Notify(ctx, n)
+}
+
+// 依寄送結果更新通知狀態
+func (w *Worker) finish(msg models.OutboxMessage, sendErr error) {
+	now := time.Now()
+	updates := map[string]interface{}{}
+
+	switch {
+	case sendErr == nil:
+		updates["status"] = models.OutboxSent
+		updates["sent_at"] = now
+	case errors.Is(sendErr, errSkipped):
+		updates["status"] = models.OutboxSkipped
+	default:
+		attempts := msg.Attempts + 1
+		updates["attempts"] = attempts
+		updates["last_error"] = sendErr.Error()
+		if errors.Is(sendErr, errPermanent) || attempts >= w.maxAttempts {
+			updates["status"] = models.OutboxDead
+			log.Printf("通知 #%d 寄送失敗，已停止重試: %v\n", msg.ID, sendErr)
+		} else {
+			updates["next_attempt_at"] = now.Add(w.backoff(attempts))
+			log.Printf("通知 #%d 寄送失敗，稍後重試（第 %d 次）: %v\n", msg.ID, attempts, sendErr)
+		}
+	}
+
+	if err := w.db.Model(&models.OutboxMessage{}).Where("id = ?", msg.ID).Updates(updates).Error; err != nil {
+		log.Printf("更新通知 #%d 狀態失敗: %v\n", msg.ID, err)
+	}
+}
+
+// 指數退避並加上隨機抖動，避免大量通知同時重試
+func (w *Worker) backoff(attempts int) time.Duration {
+	delay := w.retryBase << (attempts - 1)
+	if delay <= 0 || delay > w.retryMax {
+		delay = w.retryMax
+	}
+	jitter := time.Duration(rand.Int64N(int64(delay)/5 + 1))
+	return delay + jitter
+}
@@ -1,8 +1,10 @@
 package routers
 
 import (
+	"messageboard/config"
 	"messageboard/controllers"
 	middleware "messageboard/middlewares"
+	"messageboard/models"
 	"os"
 	"strings"
 
@@ -10,6 +12,7 @@ import (
 	"github.com/gin-gonic/gin"
 )
 
+// 全域允許的來源（ALLOWED_ORIGINS），各網站的來源另於網站設定中管理
 func getAllowedOrigins() []string {
 	// 從環境變數讀取允許的來源
 	origins := os.Getenv("ALLOWED_ORIGINS")
@@ -20,50 +23,145 @@ func getAllowedOrigins() []string {
 	return strings.Split(origins, ",")
 }
 
+// 檢查來源是否允許跨站請求：全域允許的來源或任一網站設定的來源
+func isAllowedOrigin(origin string) bool {
+	for _, allowed := range getAllowedOrigins() {
+		if strings.TrimSpace(allowed) == origin {
+			return true
+		}
+	}
+	return models.IsSiteOrigin(origin)
+}
+
+// 讀取限流設定：<prefix>_PER_MINUTE 為每分鐘次數，<prefix>_BURST 為突發上限，未設定時使用預設值
+func rateLimitPolicy(prefix string, perMinute float64, burst int) middleware.RateLimitPolicy {
+	if value := config.GetEnvAsFloat(prefix+"_PER_MINUTE", perMinute); value > 0 {
+		perMinute = value
+	}
+	if value := config.GetEnvAsInt(prefix+"_BURST", burst); value > 0 {
+		burst = value
+	}
+	return middleware.RateLimitPolicy{Name: prefix, PerMinute: perMinute, Burst: burst}
+}
+
 func SetupRouter() *gin.Engine {
 	r := gin.Default()
 
+	// 用戶端 IP 由 ResolveClientIP 依信任的代理解析後寫回，c.ClientIP() 直接使用連線位址
+	r.ForwardedByClientIP = false
+	r.SetTrustedProxies(nil)
+	r.Use(middleware.ResolveClientIP())
+
 	// 配置 CORS 中介軟體
 	r.Use(cors.New(cors.Config{
-		AllowOrigins:     getAllowedOrigins(),
+		AllowOriginFunc:  isAllowedOrigin,
 		AllowMethods:     []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowHeaders:     []string{"Origin", "Authorization", "Content-Type"},
-		ExposeHeaders:    []string{"Content-Length"},
+		AllowHeaders:     []string{"Origin", "Authorization", "Content-Type", "X-Edit-Token"},
+		ExposeHeaders:    []string{"Content-Length", "RateLimit-Limit", "RateLimit-Remaining", "RateLimit-Reset", "Retry-After"},
 		AllowCredentials: true,
 	}))
 
-	// IP 限流
-	r.Use(middleware.RateLimitPerIP())
+	// 全域 IP 限流，各路由群組另有各自的限流規則
+	r.Use(middleware.RateLimitPerIP(rateLimitPolicy("RATE_LIMIT_IP", 300, 60)))
 
 	api := r.Group("/api")
 	v1 := api.Group("/v1")
 
+	// Account routes (註冊、登入等帳號操作，較嚴格的 IP 限流)
+	account := v1.Group("/")
+	account.Use(middleware.RateLimitPerIP(rateLimitPolicy("RATE_LIMIT_AUTH", 20, 10)))
+	{
+		account.POST("/register", controllers.Register)
+		account.POST("/login", controllers.Login)
+		account.POST("/token/refresh", controllers.RefreshToken)                                                                                     // POST /api/v1/token/refresh
+		account.GET("/verify-email", controllers.VerifyEmail)                                                                                        // GET /api/v1/verify-email?token=xxx（Email 連結）
+		account.POST("/verify-email", controllers.VerifyEmail)                                                                                       // POST /api/v1/verify-email
+		account.POST("/password/forgot", middleware.RateLimitPerIP(rateLimitPolicy("RATE_LIMIT_PASSWORD_FORGOT", 5, 3)), controllers.ForgotPassword) // POST /api/v1/password/forgot
+		account.POST("/password/reset", controllers.ResetPassword)                                                                                   // POST /api/v1/password/reset
+	}
+
 	// Public routes
-	v1.POST("/register", controllers.Register)
-	v1.POST("/login", controllers.Login)
+	v1.GET("/captcha/challenge", controllers.GetCaptchaChallenge) // GET /api/v1/captcha/challenge
+	v1.GET("/unsubscribe", controllers.GetUnsubscribe)            // GET /api/v1/unsubscribe?token=xxx（Email 連結，僅確認範圍）
+	v1.POST("/unsubscribe", controllers.Unsubscribe)              // POST /api/v1/unsubscribe?token=xxx（一鍵取消訂閱）
 
 	// Public comment routes (不需要認證)
 	publicComments := v1.Group("/comments")
+	publicComments.Use(middleware.OptionalJWTAuth())
+	{
+		publicComments.GET("", controllers.GetComments)                                                                               // GET /api/v1/comments/
+		publicComments.POST("", middleware.RateLimitGuestPerIP(rateLimitPolicy("GUEST_RATE_LIMIT", 2, 2)), controllers.CreateComment) // POST /api/v1/comments/（未登入時需開啟訪客模式）
+		publicComments.GET("/by-url", controllers.GetCommentsByURL)                                                                   // GET /api/v1/comments/by-url?url=xxx
+		publicComments.GET("/thread", controllers.GetCommentThread)                                                                   // GET /api/v1/comments/thread?url=xxx&max_depth=3
+		publicComments.GET("/:id", controllers.GetCommentByID)                                                                        // GET /api/v1/comments/:id
+		publicComments.GET("/:id/likes", controllers.GetCommentLikes)                                                                 // GET /api/v1/comments/:id/likes
+		publicComments.GET("/:id/replies", controllers.GetCommentReplies)                                                             // GET /api/v1/comments/:id/replies
+	}
+
+	// Guest comment routes (訪客以編輯權杖修改、刪除自己的留言)
+	guestComments := v1.Group("/guest/comments")
 	{
-		publicComments.GET("", controllers.GetComments)               // GET /api/v1/comments/
-		publicComments.GET("/by-url", controllers.GetCommentsByURL)   // GET /api/v1/comments/by-url?url=xxx
-		publicComments.GET("/:id", controllers.GetCommentByID)        // GET /api/v1/comments/:id
-		publicComments.GET("/:id/likes", controllers.GetCommentLikes) // GET /api/v1/comments/:id/likes
+		guestComments.PUT("/:id", controllers.UpdateGuestComment)    // PUT /api/v1/guest/comments/:id（X-Edit-Token 標頭）
+		guestComments.DELETE("/:id", controllers.DeleteGuestComment) // DELETE /api/v1/guest/comments/:id（X-Edit-Token 標頭）
 	}
 
 	// Protected routes (需要認證)
 	authGroup := v1.Group("/")
-	authGroup.Use(middleware.JWTAuth())
+	authGroup.Use(middleware.JWTAuth(), middleware.RateLimitPerUser(rateLimitPolicy("RATE_LIMIT_USER", 120, 30)))
 
 	// Protected comment routes (需要認證的寫入操作)
 	protectedComments := authGroup.Group("/comments")
 	{
-		protectedComments.POST("", controllers.CreateComment)              // POST /api/v1/comments/
-		protectedComments.PUT("/:id", controllers.UpdateComment)           // PUT /api/v1/comments/:id
-		protectedComments.DELETE("/:id", controllers.DeleteComment)        // DELETE /api/v1/comments/:id
-		protectedComments.POST("/:id/like", controllers.ToggleCommentLike) // POST /api/v1/comments/:id/like
+		protectedComments.PUT("/:id", middleware.RequirePermission(models.PermCommentUpdateOwn), controllers.UpdateComment)                                                                              // PUT /api/v1/comments/:id
+		protectedComments.DELETE("/:id", middleware.RequirePermission(models.PermCommentDeleteOwn, models.PermCommentDeleteAny), controllers.DeleteComment)                                              // DELETE /api/v1/comments/:id
+		protectedComments.POST("/:id/like", middleware.RequirePermission(models.PermCommentLike), middleware.RateLimitPerUser(rateLimitPolicy("LIKE_RATE_LIMIT", 20, 5)), controllers.ToggleCommentLike) // POST /api/v1/comments/:id/like
+		protectedComments.POST("/:id/report", middleware.RequirePermission(models.PermCommentReport), controllers.ReportComment)                                                                         // POST /api/v1/comments/:id/report
 	}
 
+	authGroup.POST("/logout", controllers.Logout) // POST /api/v1/logout
+
+	// Current user routes (目前登入的使用者)
+	me := authGroup.Group("/me")
+	{
+		me.GET("/notifications", controllers.GetNotificationPreference)                                                                                 // GET /api/v1/me/notifications
+		me.PUT("/notifications", controllers.UpdateNotificationPreference)                                                                              // PUT /api/v1/me/notifications
+		me.PUT("/password", controllers.ChangePassword)                                                                                                 // PUT /api/v1/me/password
+		me.POST("/verify-email/resend", middleware.RateLimitPerUser(rateLimitPolicy("RATE_LIMIT_VERIFY_RESEND", 1, 3)), controllers.ResendVerification) // POST /api/v1/me/verify-email/resend
+	}
+
+	// Site routes (站長管理自己的網站設定)
+	sites := authGroup.Group("/sites")
+	sites.Use(middleware.RequirePermission(models.PermCommentModerate))
+	{
+		sites.GET("", controllers.ListSites)      // GET /api/v1/sites
+		sites.GET("/:id", controllers.GetSite)    // GET /api/v1/sites/:id
+		sites.PUT("/:id", controllers.UpdateSite) // PUT /api/v1/sites/:id
+	}
+
+	// Moderation routes (需要審核權限)
+	moderation := authGroup.Group("/moderation")
+	moderation.Use(middleware.RequirePermission(models.PermCommentModerate))
+	{
+		moderation.GET("/comments", controllers.GetModerationQueue)             // GET /api/v1/moderation/comments?status=pending
+		moderation.PUT("/comments/:id/status", controllers.UpdateCommentStatus) // PUT /api/v1/moderation/comments/:id/status
+		moderation.GET("/reports", controllers.GetReports)                      // GET /api/v1/moderation/reports?status=open
+		moderation.PUT("/reports/:id/resolve", controllers.ResolveReport)       // PUT /api/v1/moderation/reports/:id/resolve
+		moderation.PUT("/reports/:id/dismiss", controllers.DismissReport)       // PUT /api/v1/moderation/reports/:id/dismiss
+	}
+
+	// Admin routes (僅限管理員)
+	adminGroup := authGroup.Group("/admin")
+	adminGroup.Use(middleware.RequireRole(models.RoleAdmin))
+	{
+		adminGroup.DELETE("/comments/:id", controllers.PurgeComment)    // DELETE /api/v1/admin/comments/:id
+		adminGroup.POST("/sites", controllers.CreateSite)               // POST /api/v1/admin/sites
+		adminGroup.DELETE("/sites/:id", controllers.DeleteSite)         // DELETE /api/v1/admin/sites/:id
+		adminGroup.GET("/login-attempts", controllers.GetLoginAttempts) // GET /api/v1/admin/login-attempts?email=xxx&result=failure
+	}
+
+	// 公開金鑰，供第三方驗證登入 Token
+	r.GET("/.well-known/jwks.json", controllers.GetJWKS) // GET /.well-known/jwks.json
+
 	// Test route
 	r.GET("/", func(c *gin.Context) {
 		c.JSON(200, gin.H{